@@ -8,16 +8,26 @@ package circonusllhist
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"sync"
 )
 
 const (
 	DEFAULT_HIST_SIZE = int16(100)
+	// DEFAULT_DIGITS is precision of histograms made by New
+	DEFAULT_DIGITS = 2
+	// MAX_BINS is the most bins a histogram can index
+	MAX_BINS = math.MaxInt16
 )
 
+// ErrTooManyBins is returned when a new bin doesn't fit into a histogram
+// without a cap on the number of bins.
+var ErrTooManyBins = errors.New("histogram has too many bins")
+
 var power_of_ten = [...]float64{
 	1, 10, 100, 1000, 10000, 100000, 1e+06, 1e+07, 1e+08, 1e+09, 1e+10,
 	1e+11, 1e+12, 1e+13, 1e+14, 1e+15, 1e+16, 1e+17, 1e+18, 1e+19, 1e+20,
@@ -48,14 +58,18 @@ var power_of_ten = [...]float64{
 	1e-05, 0.0001, 0.001, 0.01, 0.1,
 }
 
-// A Bracket is a part of a cumulative distribution.
+// A Bracket is a part of a cumulative distribution. Value of a bin is
+// val/scale*10^exp, val keeps at least two digits, so vals of one digit
+// bins are multiples of ten.
 type Bin struct {
-	val   int8
-	exp   int8
-	count uint64
+	val    int16
+	exp    int8
+	digits int8
+	count  uint64
 }
 
-func NewBinRaw(val int8, exp int8, count uint64) *Bin {
+// NewBinRaw returns a bin of DEFAULT_DIGITS precision.
+func NewBinRaw(val int16, exp int8, count uint64) *Bin {
 	return &Bin{
 		val:   val,
 		exp:   exp,
@@ -70,6 +84,46 @@ func NewBinFromFloat64(d float64) *Bin {
 	hb.SetFromFloat64(d)
 	return hb
 }
+
+// Digits returns number of significant decimal digits of the bin.
+func (hb *Bin) Digits() int {
+	if hb.digits == 0 {
+		return DEFAULT_DIGITS
+	}
+	return int(hb.digits)
+}
+
+// scale is val of the first bin of a decade, step is the difference
+// between vals of neighbouring bins.
+func (hb *Bin) scale() (scale int16, step int16) {
+	switch hb.Digits() {
+	case 1:
+		return 10, 10
+	case 3:
+		return 100, 1
+	}
+	return 10, 1
+}
+
+// coarsen returns the bin of digits precision containing hb,
+// digits must not exceed precision of hb.
+func (hb *Bin) coarsen(digits int8) Bin {
+	out := *hb
+	out.digits = digits
+	scale, _ := hb.scale()
+	if int(digits) == hb.Digits() || hb.val == 0 || hb.IsNaN() ||
+		(hb.val < scale && hb.val > -scale) {
+		return out
+	}
+	outScale, outStep := out.scale()
+	// bins are floors of magnitude, so truncation toward zero
+	// keeps the sign of val
+	out.val = hb.val / (scale / outScale)
+	out.val -= out.val % outStep
+	return out
+}
+
+// SetFromFloat64 sets the bin containing d keeping precision of the bin.
 func (hb *Bin) SetFromFloat64(d float64) *Bin {
 	hb.val = -1
 	if math.IsInf(d, 0) || math.IsNaN(d) {
@@ -93,10 +147,12 @@ func (hb *Bin) SetFromFloat64(d float64) *Bin {
 		}
 		return hb
 	}
+	scale, step := hb.scale()
 	d = d / hb.PowerOfTen()
-	d = d * 10
-	hb.val = int8(sign * int(math.Floor(d+1e-13)))
-	if hb.val == 100 || hb.val == -100 {
+	d = d * float64(scale)
+	val := int(math.Floor(d + 1e-13))
+	hb.val = int16(sign * (val - val%int(step)))
+	if hb.val == 10*scale || hb.val == -10*scale {
 		if hb.exp < 127 {
 			hb.val = hb.val / 10
 			hb.exp++
@@ -109,8 +165,8 @@ func (hb *Bin) SetFromFloat64(d float64) *Bin {
 		hb.exp = 0
 		return hb
 	}
-	if !((hb.val >= 10 && hb.val < 100) ||
-		(hb.val <= -10 && hb.val > -100)) {
+	if !((hb.val >= scale && hb.val < 10*scale) ||
+		(hb.val <= -scale && hb.val > -10*scale)) {
 		hb.val = -1
 		hb.exp = 0
 	}
@@ -125,12 +181,13 @@ func (hb *Bin) PowerOfTen() float64 {
 }
 
 func (hb *Bin) IsNaN() bool {
-	if hb.val > 99 || hb.val < -99 {
+	scale, _ := hb.scale()
+	if hb.val >= 10*scale || hb.val <= -10*scale {
 		return true
 	}
 	return false
 }
-func (hb *Bin) Val() int8 {
+func (hb *Bin) Val() int16 {
 	return hb.val
 }
 func (hb *Bin) Exp() int8 {
@@ -143,19 +200,21 @@ func (hb *Bin) Value() float64 {
 	if hb.IsNaN() {
 		return math.NaN()
 	}
-	if hb.val < 10 && hb.val > -10 {
+	scale, _ := hb.scale()
+	if hb.val < scale && hb.val > -scale {
 		return 0.0
 	}
-	return (float64(hb.val) / 10.0) * hb.PowerOfTen()
+	return (float64(hb.val) / float64(scale)) * hb.PowerOfTen()
 }
 func (hb *Bin) BinWidth() float64 {
 	if hb.IsNaN() {
 		return math.NaN()
 	}
-	if hb.val < 10 && hb.val > -10 {
+	scale, step := hb.scale()
+	if hb.val < scale && hb.val > -scale {
 		return 0.0
 	}
-	return hb.PowerOfTen() / 10.0
+	return hb.PowerOfTen() * float64(step) / float64(scale)
 }
 func (hb *Bin) Midpoint() float64 {
 	if hb.IsNaN() {
@@ -232,21 +291,74 @@ func (h1 *Bin) Compare(h2 *Bin) int {
 }
 
 // This histogram structure tracks values are two decimal digits of precision
-// with a bounded error that remains bounded upon composition
+// (one to three if configured) with a bounded error that remains bounded
+// upon composition
 type Histogram struct {
 	mutex  sync.Mutex
 	bvs    []Bin
 	used   int16
 	allocd int16
+	digits int8
+	// 0 if number of bins isn't capped
+	maxBins int16
+}
+
+// Config is precision and size of a histogram.
+type Config struct {
+	// Digits is number of significant decimal digits of bins, 1 to 3,
+	// 0 means DEFAULT_DIGITS. Width of a bin is within 10^(1-Digits)
+	// of its value.
+	Digits int
+	// MaxBins caps number of bins, lowest bins are collapsed when a new
+	// bin doesn't fit (see InsertBin). If 0, the number isn't capped and
+	// ErrTooManyBins is returned past MAX_BINS bins.
+	MaxBins int
 }
 
 // New returns a new Histogram
 func New() *Histogram {
-	return &Histogram{
-		allocd: DEFAULT_HIST_SIZE,
-		used:   0,
-		bvs:    make([]Bin, DEFAULT_HIST_SIZE),
+	h, _ := NewWithConfig(Config{})
+	return h
+}
+
+// NewWithConfig returns a new Histogram of the given precision and size.
+func NewWithConfig(config Config) (*Histogram, error) {
+	if config.Digits == 0 {
+		config.Digits = DEFAULT_DIGITS
 	}
+	if config.Digits < 1 || config.Digits > 3 {
+		return nil, fmt.Errorf("%d digits precision isn't supported, 1 to 3 digits are", config.Digits)
+	}
+	if config.MaxBins < 0 || config.MaxBins > MAX_BINS {
+		return nil, fmt.Errorf("max bins must be within [0, %d], got %d", MAX_BINS, config.MaxBins)
+	}
+	h := &Histogram{
+		digits:  int8(config.Digits),
+		maxBins: int16(config.MaxBins),
+	}
+	h.allocd = h.initialSize()
+	h.bvs = make([]Bin, h.allocd)
+	return h, nil
+}
+
+// Config returns precision and size the histogram was created with.
+func (h *Histogram) Config() Config {
+	return Config{Digits: int(h.digits), MaxBins: int(h.maxBins)}
+}
+
+func (h *Histogram) initialSize() int16 {
+	if h.maxBins > 0 && h.maxBins < DEFAULT_HIST_SIZE {
+		return h.maxBins
+	}
+	return DEFAULT_HIST_SIZE
+}
+
+// binLimit is the most bins the histogram can have.
+func (h *Histogram) binLimit() int16 {
+	if h.maxBins > 0 {
+		return h.maxBins
+	}
+	return MAX_BINS
 }
 
 // UsedMem returns the approximate memory usage.
@@ -320,7 +432,8 @@ func (h *Histogram) InternalFind(hb *Bin) (bool, int16) {
 	l := int16(0)
 	r := h.used - 1
 	for l < r {
-		check := (r + l) / 2
+		// r + l overflows past half of MAX_BINS
+		check := l + (r-l)/2
 		rv = h.bvs[check].Compare(hb)
 		if rv == 0 {
 			l = check
@@ -345,32 +458,54 @@ func (h *Histogram) InternalFind(hb *Bin) (bool, int16) {
 	return false, idx
 }
 
-func (h *Histogram) InsertBin(hb *Bin, count int64) uint64 {
+// InsertBin adds count to the bin of the histogram containing hb, bins
+// of finer precision are coarsened to the one of the histogram, coarser
+// bins can't be inserted. If the histogram has MaxBins bins, a new bin
+// is made room for by collapsing: the lowest bin, counting the new one,
+// is folded into the next bin up. Collapsing keeps the upper quantiles
+// exact at the cost of the lowest values which are moved into higher
+// bins. Without a cap ErrTooManyBins is returned past MAX_BINS bins.
+func (h *Histogram) InsertBin(hb *Bin, count int64) (uint64, error) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	if count == 0 {
-		return 0
+		return 0, nil
+	}
+	if hb.Digits() < int(h.digits) {
+		return 0, fmt.Errorf("can't insert bin of %d digits into histogram of %d digits",
+			hb.Digits(), h.digits)
 	}
+	bin := hb.coarsen(h.digits)
+	hb = &bin
 	found, idx := h.InternalFind(hb)
+	if !found && h.used == h.binLimit() {
+		if h.maxBins == 0 {
+			return 0, ErrTooManyBins
+		}
+		found, idx, count = h.collapse(idx, count)
+	}
 	if !found {
 		if h.used == h.allocd {
-			new_bvs := make([]Bin, h.allocd+DEFAULT_HIST_SIZE)
+			allocd := h.allocd + DEFAULT_HIST_SIZE
+			if limit := h.binLimit(); h.allocd > limit-DEFAULT_HIST_SIZE {
+				allocd = limit
+			}
+			new_bvs := make([]Bin, allocd)
 			if idx > 0 {
 				copy(new_bvs[0:], h.bvs[0:idx])
 			}
 			if idx < h.used {
 				copy(new_bvs[idx+1:], h.bvs[idx:])
 			}
-			h.allocd = h.allocd + DEFAULT_HIST_SIZE
+			h.allocd = allocd
 			h.bvs = new_bvs
 		} else {
 			copy(h.bvs[idx+1:], h.bvs[idx:h.used])
 		}
-		h.bvs[idx].val = hb.val
-		h.bvs[idx].exp = hb.exp
+		h.bvs[idx] = *hb
 		h.bvs[idx].count = uint64(count)
 		h.used++
-		return h.bvs[idx].count
+		return h.bvs[idx].count, nil
 	}
 	var newval uint64
 	if count < 0 {
@@ -382,16 +517,56 @@ func (h *Histogram) InsertBin(hb *Bin, count int64) uint64 {
 		newval = ^uint64(0)
 	}
 	h.bvs[idx].count = newval
-	return newval - h.bvs[idx].count
+	return newval - h.bvs[idx].count, nil
+}
+
+// collapse makes room for a new bin going to idx of a full histogram,
+// see InsertBin. Returns whether the new bin is folded into an existing
+// one, where the new bin goes and its count.
+func (h *Histogram) collapse(idx int16, count int64) (bool, int16, int64) {
+	if idx == 0 {
+		// the new bin is the lowest, the first bin takes its count
+		return true, 0, count
+	}
+	lowest := h.bvs[0].count
+	copy(h.bvs[0:], h.bvs[1:h.used])
+	h.used--
+	idx--
+	if idx == 0 {
+		// the lowest bin is folded into the new one
+		if total := count + int64(lowest); total >= count {
+			return false, 0, total
+		}
+		return false, 0, math.MaxInt64
+	}
+	if h.bvs[0].count+lowest < lowest { //rolled
+		h.bvs[0].count = ^uint64(0)
+	} else {
+		h.bvs[0].count += lowest
+	}
+	return false, idx, count
 }
 
 // RecordValues records n occurrences of the given value, returning an error if
 // the value is out of range.
 func (h *Histogram) RecordValues(v float64, n int64) error {
-	var hb Bin
+	hb := Bin{digits: h.digits}
 	hb.SetFromFloat64(v)
-	h.InsertBin(&hb, n)
-	return nil
+	_, err := h.InsertBin(&hb, n)
+	return err
+}
+
+// Bins returns a copy of non empty bins in ascending order.
+func (h *Histogram) Bins() []Bin {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	bins := make([]Bin, 0, h.used)
+	for _, bin := range h.bvs[0:h.used] {
+		if bin.count > 0 {
+			bins = append(bins, bin)
+		}
+	}
+	return bins
 }
 
 // Approximate mean
@@ -425,9 +600,43 @@ func (h *Histogram) ApproxSum() float64 {
 	return sum
 }
 
+// ApproxQuantile returns quantiles q_in (ascending), values are assumed
+// to be spread evenly within bins and quantile q is at rank q*count.
 func (h *Histogram) ApproxQuantile(q_in []float64) ([]float64, error) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
+	return h.approxQuantile(q_in, func(total_cnt, q float64) float64 {
+		return total_cnt * q
+	})
+}
+
+// ApproxQuantile1 is ApproxQuantile of type 1 (inverted CDF): quantile q is
+// the right edge of the share of the bin taken by value ceil(q*count).
+func (h *Histogram) ApproxQuantile1(q_in []float64) ([]float64, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.approxQuantile(q_in, func(total_cnt, q float64) float64 {
+		return math.Ceil(total_cnt * q)
+	})
+}
+
+// ApproxQuantile7 is ApproxQuantile of type 7 (linear): values are at
+// middles of their shares of bins and quantile q is interpolated between
+// values (count-1)*q and (count-1)*q+1.
+func (h *Histogram) ApproxQuantile7(q_in []float64) ([]float64, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.approxQuantile(q_in, func(total_cnt, q float64) float64 {
+		return (total_cnt-1)*q + 0.5
+	})
+}
+
+// approxQuantile looks up quantiles by rank, rank is a position in
+// the total count where bin i covers counts of bins before it
+// up to the count including bin i.
+func (h *Histogram) approxQuantile(q_in []float64,
+	rank func(total_cnt, q float64) float64) ([]float64, error) {
+
 	q_out := make([]float64, len(q_in))
 	i_q, i_b := 0, int16(0)
 	total_cnt, bin_width, bin_left, lower_cnt, upper_cnt := 0.0, 0.0, 0.0, 0.0, 0.0
@@ -454,7 +663,7 @@ func (h *Histogram) ApproxQuantile(q_in []float64) ([]float64, error) {
 		if q_in[i_q] < 0.0 || q_in[i_q] > 1.0 {
 			return nil, errors.New("out of bound quantile")
 		}
-		q_out[i_q] = total_cnt * q_in[i_q]
+		q_out[i_q] = rank(total_cnt, q_in[i_q])
 	}
 
 	for i_b = 0; i_b < h.used; i_b++ {
@@ -497,27 +706,39 @@ func (h *Histogram) ValueAtQuantile(q float64) float64 {
 	defer h.mutex.Unlock()
 	q_in := make([]float64, 1)
 	q_in[0] = q
-	q_out, err := h.ApproxQuantile(q_in)
+	q_out, err := h.approxQuantile(q_in, func(total_cnt, q float64) float64 {
+		return total_cnt * q
+	})
 	if err == nil && len(q_out) == 1 {
 		return q_out[0]
 	}
 	return math.NaN()
 }
 
-func (h *Histogram) Merge(another *Histogram) {
+// Merge adds bins of another histogram, which must be of the same or finer
+// precision, see InsertBin. Bins merged before an error are kept.
+func (h *Histogram) Merge(another *Histogram) error {
+	if another.digits < h.digits {
+		return fmt.Errorf("can't merge histogram of %d digits into histogram of %d digits",
+			another.digits, h.digits)
+	}
 	another.mutex.Lock()
 	defer another.mutex.Unlock()
-	for bidx := range another.bvs {
+	// bins above used are leftovers of Reset
+	for bidx := range another.bvs[0:another.used] {
 		bin := &another.bvs[bidx]
-		h.InsertBin(bin, int64(bin.count))
+		if _, err := h.InsertBin(bin, int64(bin.count)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // SignificantFigures returns the significant figures used to create the
 // histogram
 // CH Compat
 func (h *Histogram) SignificantFigures() int64 {
-	return 2
+	return int64(h.digits)
 }
 
 // Equals returns true if the two Histograms are equivalent, false if not.
@@ -543,16 +764,115 @@ func (h *Histogram) Equals(other *Histogram) bool {
 	return true
 }
 
+// configMarker starts serialized histograms of non default configuration,
+// it can't be a number of bins.
+const configMarker = int16(-1)
+
+// Serialize writes the histogram in binary form: number of bins followed by
+// val, exp and count of every bin. Count is stored as its length in bytes
+// minus one followed by big endian bytes of the count. Histograms of non
+// default configuration start with configMarker, digits (a byte) and
+// max bins (int16), their vals take two bytes.
+func (h *Histogram) Serialize(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	buf := new(bytes.Buffer)
+	configured := h.digits != DEFAULT_DIGITS || h.maxBins != 0
+	if configured {
+		_ = binary.Write(buf, binary.BigEndian, configMarker)
+		buf.WriteByte(byte(h.digits))
+		_ = binary.Write(buf, binary.BigEndian, h.maxBins)
+	}
+	_ = binary.Write(buf, binary.BigEndian, h.used)
+	var count [8]byte
+	for _, bin := range h.bvs[0:h.used] {
+		if configured {
+			_ = binary.Write(buf, binary.BigEndian, bin.val)
+		} else {
+			buf.WriteByte(byte(bin.val))
+		}
+		buf.WriteByte(byte(bin.exp))
+		binary.BigEndian.PutUint64(count[:], bin.count)
+		skip := 0
+		for skip < 7 && count[skip] == 0 {
+			skip++
+		}
+		buf.WriteByte(byte(7 - skip))
+		buf.Write(count[skip:])
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Deserialize reads a histogram written by Serialize.
+func Deserialize(r io.Reader) (*Histogram, error) {
+	var nbins int16
+	if err := binary.Read(r, binary.BigEndian, &nbins); err != nil {
+		return nil, err
+	}
+	h := New()
+	configured := nbins == configMarker
+	if configured {
+		var config struct {
+			Digits  uint8
+			MaxBins int16
+		}
+		if err := binary.Read(r, binary.BigEndian, &config); err != nil {
+			return nil, err
+		}
+		var err error
+		h, err = NewWithConfig(Config{Digits: int(config.Digits), MaxBins: int(config.MaxBins)})
+		if err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &nbins); err != nil {
+			return nil, err
+		}
+	}
+	if nbins < 0 {
+		return nil, errors.New("invalid number of bins")
+	}
+	header := make([]byte, 3)
+	if configured {
+		header = make([]byte, 4)
+	}
+	var count [8]byte
+	for i := int16(0); i < nbins; i++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		bin := Bin{val: int16(int8(header[0])), exp: int8(header[1]), digits: h.digits}
+		if configured {
+			bin.val = int16(binary.BigEndian.Uint16(header))
+			bin.exp = int8(header[2])
+		}
+		length := header[len(header)-1]
+		if length > 7 {
+			return nil, fmt.Errorf("invalid bin count length %d", length+1)
+		}
+		count = [8]byte{}
+		if _, err := io.ReadFull(r, count[7-length:]); err != nil {
+			return nil, err
+		}
+		if _, err := h.InsertBin(&bin, int64(binary.BigEndian.Uint64(count[:]))); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
 func (h *Histogram) CopyAndReset() *Histogram {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	newhist := &Histogram{
-		allocd: h.allocd,
-		used:   h.used,
-		bvs:    h.bvs,
-	}
-	h.allocd = DEFAULT_HIST_SIZE
-	h.bvs = make([]Bin, DEFAULT_HIST_SIZE)
+		allocd:  h.allocd,
+		used:    h.used,
+		bvs:     h.bvs,
+		digits:  h.digits,
+		maxBins: h.maxBins,
+	}
+	h.allocd = h.initialSize()
+	h.bvs = make([]Bin, h.allocd)
 	h.used = 0
 	return newhist
 }
@@ -563,7 +883,7 @@ func (h *Histogram) DecStrings() []string {
 	for i, bin := range h.bvs[0:h.used] {
 		var buffer bytes.Buffer
 		buffer.WriteString("H[")
-		buffer.WriteString(fmt.Sprintf("%3.1e", bin.Value()))
+		buffer.WriteString(fmt.Sprintf("%3.*e", int(h.digits)-1, bin.Value()))
 		buffer.WriteString("]=")
 		buffer.WriteString(fmt.Sprintf("%v", bin.count))
 		out[i] = buffer.String()
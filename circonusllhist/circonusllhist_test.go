@@ -1,13 +1,15 @@
 package circonusllhist_test
 
 import (
+	"bytes"
+	"fmt"
 	"math"
 	"testing"
 
 	hist "github.com/circonus-labs/circonusllhist"
 )
 
-func helpTestBin(t *testing.T, v float64, val, exp int8) {
+func helpTestBin(t *testing.T, v float64, val int16, exp int8) {
 	b := hist.NewBinFromFloat64(v)
 	if b.Val() != val || b.Exp() != exp {
 		t.Errorf("%v -> [%v,%v] expected, but got [%v,%v]", v, val, exp, b.Val(), b.Exp())
@@ -113,6 +115,179 @@ func TestMerge(t *testing.T) {
 		[]float64{0, 0.4355, 0.4391, 0.44})
 }
 
+func TestMergeAfterReset(t *testing.T) {
+	h1 := hist.New()
+	h2 := hist.New()
+	h2.RecordValue(1000)
+	h2.Reset()
+	h2.RecordValue(1)
+	h1.Merge(h2)
+	if out := h1.DecStrings(); len(out) != 1 || out[0] != "H[1.0e+00]=1" {
+		t.Errorf("unexpected bins after merge %v", out)
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	h := hist.New()
+	for _, sample := range s1 {
+		h.RecordValue(sample)
+	}
+	h.RecordValues(-12345, 1<<40)
+	var buf bytes.Buffer
+	if err := h.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := hist.Deserialize(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Equals(h2) {
+		t.Errorf("deserialized %v != %v", h2.DecStrings(), h.DecStrings())
+	}
+	if _, err := hist.Deserialize(bytes.NewReader([]byte{0, 1, 10})); err == nil {
+		t.Error("expected error on truncated input")
+	}
+}
+
+func TestDigits(t *testing.T) {
+	for _, c := range []struct {
+		digits int
+		v      float64
+		expect []string
+	}{
+		{1, 43.3, []string{"H[4e+01]=1"}},
+		{1, -0.00123, []string{"H[-1e-03]=1"}},
+		{2, 43.3, []string{"H[4.3e+01]=1"}},
+		{3, 43.37, []string{"H[4.33e+01]=1"}},
+		{3, -987324, []string{"H[-9.87e+05]=1"}},
+		{3, 0, []string{"H[0.00e+00]=1"}},
+	} {
+		h, err := hist.NewWithConfig(hist.Config{Digits: c.digits})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.RecordValue(c.v); err != nil {
+			t.Fatal(err)
+		}
+		if out := h.DecStrings(); len(out) != 1 || out[0] != c.expect[0] {
+			t.Errorf("%d digits: %v -> %v != %v", c.digits, c.v, out, c.expect)
+		}
+		if h.SignificantFigures() != int64(c.digits) {
+			t.Errorf("%d digits: significant figures %v", c.digits, h.SignificantFigures())
+		}
+		bin := h.Bins()[0]
+		if c.v != 0 && (math.Abs(bin.BinWidth()/bin.Value()) > math.Pow(10, float64(1-c.digits)) ||
+			math.Abs(bin.Value()) > math.Abs(c.v) || math.Abs(bin.Value())+bin.BinWidth() <= math.Abs(c.v)) {
+			t.Errorf("%d digits: %v isn't in bin %v wide %v", c.digits, c.v, bin.Value(), bin.BinWidth())
+		}
+	}
+	for _, digits := range []int{-1, 4} {
+		if _, err := hist.NewWithConfig(hist.Config{Digits: digits}); err == nil {
+			t.Errorf("expected error for %d digits", digits)
+		}
+	}
+	if _, err := hist.NewWithConfig(hist.Config{MaxBins: hist.MAX_BINS + 1}); err == nil {
+		t.Error("expected error for too many max bins")
+	}
+}
+
+func TestMaxBins(t *testing.T) {
+	h, err := hist.NewWithConfig(hist.Config{MaxBins: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{10, 20, 30, 40, 50} {
+		if err := h.RecordValue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 10 and 20 are folded into 30
+	expect := []string{"H[3.0e+01]=3", "H[4.0e+01]=1", "H[5.0e+01]=1"}
+	if out := h.DecStrings(); fmt.Sprint(out) != fmt.Sprint(expect) {
+		t.Errorf("collapsed bins %v != %v", out, expect)
+	}
+	// lower values go to the lowest bin
+	h.RecordValues(1, 2)
+	expect[0] = "H[3.0e+01]=5"
+	if out := h.DecStrings(); fmt.Sprint(out) != fmt.Sprint(expect) {
+		t.Errorf("collapsed bins %v != %v", out, expect)
+	}
+	if q := h.ValueAtQuantile(1); !fuzzy_equals(51, q) {
+		t.Errorf("max %v != 51", q)
+	}
+
+	one, _ := hist.NewWithConfig(hist.Config{MaxBins: 1})
+	for _, v := range []float64{3, 1, 2} {
+		one.RecordValue(v)
+	}
+	if out := one.DecStrings(); len(out) != 1 || out[0] != "H[3.0e+00]=3" {
+		t.Errorf("single bin %v", out)
+	}
+}
+
+func TestTooManyBins(t *testing.T) {
+	h, _ := hist.NewWithConfig(hist.Config{Digits: 3})
+	capped, _ := hist.NewWithConfig(hist.Config{Digits: 3, MaxBins: 1000})
+	var err error
+	for exp := -100; exp <= 100 && err == nil; exp++ {
+		for val := 100; val < 1000 && err == nil; val++ {
+			v := float64(val) * math.Pow(10, float64(exp))
+			err = h.RecordValue(v)
+			if err := capped.RecordValue(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err != hist.ErrTooManyBins {
+		t.Errorf("expected ErrTooManyBins, got %v", err)
+	}
+	if n := len(h.Bins()); n != hist.MAX_BINS {
+		t.Errorf("%d bins recorded, %d expected", n, hist.MAX_BINS)
+	}
+	if n := len(capped.Bins()); n != 1000 {
+		t.Errorf("%d capped bins, 1000 expected", n)
+	}
+	if capped.UsedMem() >= h.UsedMem()/10 {
+		t.Errorf("capped histogram uses %d bytes", capped.UsedMem())
+	}
+}
+
+func TestMergeDigits(t *testing.T) {
+	fine, _ := hist.NewWithConfig(hist.Config{Digits: 3})
+	coarse, _ := hist.NewWithConfig(hist.Config{Digits: 1})
+	fine.RecordValue(123.4)
+	fine.RecordValue(-0.987)
+	if err := coarse.Merge(fine); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"H[-9e-01]=1", "H[1e+02]=1"}
+	if out := coarse.DecStrings(); fmt.Sprint(out) != fmt.Sprint(expect) {
+		t.Errorf("coarsened bins %v != %v", out, expect)
+	}
+	if err := fine.Merge(coarse); err == nil {
+		t.Error("expected error merging coarser histogram")
+	}
+}
+
+func TestSerializeConfig(t *testing.T) {
+	h, _ := hist.NewWithConfig(hist.Config{Digits: 3, MaxBins: 10})
+	for _, sample := range s1 {
+		h.RecordValue(sample)
+	}
+	h.RecordValues(-987.6, 1<<40)
+	var buf bytes.Buffer
+	if err := h.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := hist.Deserialize(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Equals(h2) || h2.Config() != h.Config() {
+		t.Errorf("deserialized %v %v != %v %v", h2.Config(), h2.DecStrings(), h.Config(), h.DecStrings())
+	}
+}
+
 func helpQTest(t *testing.T, h *hist.Histogram, vals, qin, qexpect []float64) {
 	for _, sample := range vals {
 		h.RecordValue(sample)
@@ -140,6 +315,35 @@ func TestQuantiles(t *testing.T) {
 		[]float64{1.1})
 }
 
+func TestQuantileTypes(t *testing.T) {
+	h := hist.New()
+	h.RecordValue(1.0)
+	h.RecordValue(2.0)
+	qin := []float64{0, 0.5, 1}
+	for _, c := range []struct {
+		name     string
+		quantile func([]float64) ([]float64, error)
+		qexpect  []float64
+	}{
+		{"default", h.ApproxQuantile, []float64{1, 1.1, 2.1}},
+		{"type 1", h.ApproxQuantile1, []float64{1, 1.1, 2.1}},
+		{"type 7", h.ApproxQuantile7, []float64{1.05, 1.1, 2.05}},
+	} {
+		qout, err := c.quantile(qin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, q := range qout {
+			if !fuzzy_equals(c.qexpect[i], q) {
+				t.Errorf("%s q(%v) -> %v != %v", c.name, qin[i], q, c.qexpect[i])
+			}
+		}
+	}
+	if q := h.ValueAtQuantile(0.5); !fuzzy_equals(1.1, q) {
+		t.Errorf("ValueAtQuantile(0.5) -> %v != 1.1", q)
+	}
+}
+
 func BenchmarkHistogramRecordValue(b *testing.B) {
 	h := hist.New()
 	for i := 0; i < 1000000; i++ {
@@ -187,7 +391,7 @@ func TestConcurrent(t *testing.T) {
 			for j := 0; j < 100; j++ {
 				for i := 50; i < 100; i++ {
 					if err := h.RecordValue(float64(i)); err != nil {
-						t.Fatal(err)
+						t.Error(err)
 					}
 				}
 			}
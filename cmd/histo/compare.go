@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var resultsFile = flag.String("results", "",
+	"Store errors of the run to JSON file, see 'histo compare -h'")
+
+var results = &hdrbench.Results{}
+
+// addResults stores errors of every histogram averaged over iterations.
+func addResults(signals int, histograms HistogramList, quantilesDiff quantileDiffHistory) {
+	run := &hdrbench.RunResult{Signals: signals}
+	// start from 1 due of histograms[0] is alwasy Precise
+	for hIdx := 1; hIdx < len(histograms); hIdx++ {
+		backend := &hdrbench.BackendResult{
+			Name:    histograms[hIdx].Name(),
+			UsedMem: histograms[hIdx].UsedMem(),
+			Errors:  make([]float64, len(errorQuantiles)),
+		}
+		for iter := range quantilesDiff {
+			errorQ := hdrbench.Quantiles(quantilesDiff[iter][hIdx], errorQuantiles)
+			for qi := range errorQuantiles {
+				backend.Errors[qi] += errorQ[qi] / float64(len(quantilesDiff))
+			}
+		}
+		run.Backends = append(run.Backends, backend)
+	}
+	results.Runs = append(results.Runs, run)
+}
+
+// runMode describes how values are recorded into histograms.
+func runMode() string {
+	switch {
+	case *streamInput != "":
+		return "stream-input"
+	case *inputFile != "" || *loadFile != "":
+		return "input"
+	case *arrivals != "":
+		return "arrivals"
+	case *stream:
+		return "stream"
+	}
+	return "generated"
+}
+
+// checkResultsMode refuses -results for experiments not storing results.
+func checkResultsMode() {
+	if *resultsFile == "" {
+		return
+	}
+	modes := []struct {
+		flag string
+		set  bool
+	}{
+		{"-co", *coordinatedOmission},
+		{"-skew", *skew},
+		{"-rollup", *rollup},
+		{"-sweep", *sweep},
+		{"-repeat", *repeat > 1},
+		{"-topology", *topology != ""},
+	}
+	for _, mode := range modes {
+		if mode.set {
+			glog.Fatal("-results isn't supported with ", mode.flag)
+		}
+	}
+}
+
+func writeResults(fname string) {
+	f, err := os.Create(fname)
+	if err != nil {
+		glog.Fatal("Unable to create ", fname, ": ", err)
+	}
+	defer f.Close()
+	results.Quantiles = errorQuantiles
+	results.Config = hdrbench.RunConfig{
+		Seed:             *randSeed,
+		Datapoints:       *datapointsCount,
+		Iterations:       *iterationsCount,
+		Outliers:         *outliers,
+		SampleRate:       *sampleRate,
+		Workload:         workloadName(),
+		QuantileGrid:     *quantileGrid,
+		MinSignals:       *minSignals,
+		MaxSignals:       *maxSignals,
+		SignalMultiplier: *signalMultiplier,
+		Mode:             runMode(),
+		IntScale:         *intScale,
+		CirconusDigits:   *circonusDigits,
+		CirconusMaxBins:  *circonusMaxBins,
+	}
+	if *arrivals != "" {
+		results.Config.Arrivals = *arrivals
+		results.Config.Window = *windowWidth
+		results.Config.WindowStep = *windowStep
+	}
+	if method, _ := hdrbench.ParseQuantileMethod(*quantileMethod); method != hdrbench.NativeQuantiles {
+		results.QuantileMethod = method.String()
+	}
+	if err = hdrbench.WriteResults(f, results); err != nil {
+		glog.Fatal("Unable to write results to ", fname, ": ", err)
+	}
+}
+
+// runCompare implements 'histo compare current baseline' and returns
+// exit code: 1 if any regression found, 2 on invalid usage.
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	tolerance := flags.Float64("tolerance", 0.001,
+		"Allowed growth of relative error, 0.001 is 0.1%")
+	memTolerance := flags.Float64("mem-tolerance", 0.05,
+		"Allowed relative growth of used memory")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: histo compare [flags] current.json baseline.json")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	current, err := hdrbench.LoadResults(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to load", flags.Arg(0), ":", err)
+		return 2
+	}
+	baseline, err := hdrbench.LoadResults(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to load", flags.Arg(1), ":", err)
+		return 2
+	}
+	deltas, err := hdrbench.CompareResults(current, baseline, *tolerance, *memTolerance)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to compare:", err)
+		return 2
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "signals\tbackend\tmetric\tbaseline\tcurrent\tdelta\t")
+	regressions := 0
+	for _, delta := range deltas {
+		status := ""
+		if delta.Regression {
+			status = "REGRESSION"
+			regressions++
+		}
+		if delta.Missing {
+			fmt.Fprintf(w, "%d\t%s\tmissing\t\t\t\t%s\n", delta.Signals, delta.Backend, status)
+			continue
+		}
+		if delta.Quantile < 0 {
+			fmt.Fprintf(w, "%d\t%s\tmemory\t%.0f\t%.0f\t%+.0f\t%s\n",
+				delta.Signals, delta.Backend, delta.Baseline, delta.Current,
+				delta.Current-delta.Baseline, status)
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%s\terror %v\t%.2f%%\t%.2f%%\t%+.2f%%\t%s\n",
+			delta.Signals, delta.Backend, delta.Quantile, delta.Baseline*100,
+			delta.Current*100, (delta.Current-delta.Baseline)*100, status)
+	}
+	w.Flush()
+	if len(deltas) == 0 {
+		fmt.Fprintln(os.Stderr, "No common runs to compare")
+		return 2
+	}
+	if regressions > 0 {
+		fmt.Println(regressions, "regressions found")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+
+	"github.com/octo47/hdrbench"
+)
+
+// runGenerate implements 'histo generate out.hbd', it writes generated
+// signals to archive to be loaded with -load. Returns exit code.
+func runGenerate(args []string) int {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	signals := flags.Int("signals", 3, "Num of signals to generate")
+	datapoints := flags.Int("datapoints", 240*5, "Num of datapoints per signal")
+	outliersCount := flags.Int("outliers", 1, "Number of high latency signals")
+	seed := flags.Int64("rand", 1234, "Random seed to use")
+	workloadSpec := flags.String("workload", "", "Workloads applied to signals, see 'histo -h'")
+	arrivalsSpec := flags.String("arrivals", "", "Arrival process of values, see 'histo -h'")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: histo generate [flags] out.hbd")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	rnd := rand.New(rand.NewSource(*seed))
+	var datasets []*hdrbench.Dataset
+	if *arrivalsSpec != "" {
+		newProcess, err := hdrbench.ParseArrivals(*arrivalsSpec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid -arrivals:", err)
+			return 2
+		}
+		datasets = hdrbench.NewTimedLatencyDatasets(rnd, *datapoints, *signals, *outliersCount, newProcess)
+	} else {
+		datasets = hdrbench.NewLatencyDatasets(rnd, *datapoints, *signals, *outliersCount)
+	}
+	if *workloadSpec != "" {
+		workloads, err := hdrbench.ParseWorkloads(*workloadSpec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid -workload:", err)
+			return 2
+		}
+		datasets, _ = hdrbench.ApplyWorkloads(datasets, workloads, *seed)
+	}
+	if err := hdrbench.SaveArchive(flags.Arg(0), datasets); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to write", flags.Arg(0), ":", err)
+		return 1
+	}
+	return 0
+}
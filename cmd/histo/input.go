@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var inputFile = flag.String("input", "",
+	"Load signals from CSV (.csv, .tsv) or newline-delimited file, optionally gzipped, "+
+		"instead of generating them. Iterations cover the whole input")
+var inputValueColumn = flag.String("input-value", "0", "Column of input with values, index or name")
+var inputKeyColumn = flag.String("input-key", "",
+	"Column of input to split values into signals by, index or name")
+var inputHeader = flag.Bool("input-header", false, "First row of input contains column names")
+var inputScale = flag.Float64("input-scale", 1.0, "Multiply input values by this, e.g. 0.001 for us to ms")
+
+func loadInput() []*hdrbench.Dataset {
+	datasets, err := hdrbench.LoadFile(*inputFile, hdrbench.LoadOptions{
+		ValueColumn: *inputValueColumn,
+		KeyColumn:   *inputKeyColumn,
+		Header:      *inputHeader,
+		Scale:       *inputScale,
+	})
+	if err != nil {
+		glog.Fatal("Unable to load ", *inputFile, ": ", err)
+	}
+	if len(datasets) == 0 {
+		glog.Fatal("No values in ", *inputFile)
+	}
+	glog.Info("Loaded ", len(datasets), " signals from ", *inputFile)
+	return datasets
+}
+
+var loadFile = flag.String("load", "",
+	"Load signals from archive written by 'histo generate' instead of generating them")
+
+func loadArchive() []*hdrbench.Dataset {
+	datasets, err := hdrbench.LoadArchive(*loadFile)
+	if err != nil {
+		glog.Fatal("Unable to load ", *loadFile, ": ", err)
+	}
+	if len(datasets) == 0 {
+		glog.Fatal("No signals in ", *loadFile)
+	}
+	glog.Info("Loaded ", len(datasets), " signals from ", *loadFile)
+	return datasets
+}
@@ -3,15 +3,17 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"path"
 	"strconv"
 	"text/tabwriter"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/octo47/hdrbench"
-	"github.com/octo47/hdrbench/gnuplot"
+	"github.com/octo47/hdrbench/metrics"
 )
 
 var datapointsCount = flag.Int("datapoints", 240, "Num of datapoints per signal per iteration")
@@ -24,9 +26,23 @@ var drawDatasets = flag.Bool("draw-dataset", false,
 	"Draw datasets graphs (requires gnuplot)")
 var drawErrors = flag.Bool("draw-errors", false,
 	"Draw datasets graphs (requires gnuplot)")
+var drawPercentiles = flag.Bool("draw-percentiles", false,
+	"Draw percentile distribution of every histogram over the precise one (requires gnuplot)")
+var drawHeatmap = flag.Bool("draw-heatmap", false,
+	"Draw heatmap of errors by quantile and number of signals (requires gnuplot)")
+var gnuplotScripts = flag.Bool("gnuplot-script", false,
+	"Write gnuplot scripts and data files instead of running gnuplot")
+var writeHlog = flag.Bool("hlog", false,
+	"Write histograms of every iteration to HdrHistogram interval log")
 var randSeed = flag.Int64("rand", 1234, "Random seed to use")
 var outputDir = flag.String("workdir", ".", "Directory to put generated files to")
+var metricNames = flag.String("metrics", "",
+	"Comma separated additional error metrics to report: "+
+		"absolute, relative, rank, ks, wasserstein, max-relative")
 var intScale = flag.Float64("int-scale", 10.0, "How scale floats to int for some histograms")
+var circonusDigits = flag.Int("circonus-digits", 2, "Significant digits of Circonus histogram, 1 to 3")
+var circonusMaxBins = flag.Int("circonus-max-bins", 0,
+	"Maximal number of Circonus bins, lowest bins are collapsed past it, 0 isn't capped")
 var outliers = flag.Int("outliers", 1, "Number of high latency signal")
 
 type HistogramList []hdrbench.Histogram
@@ -34,16 +50,33 @@ type HistogramList []hdrbench.Histogram
 type quantileDiffHistory [][][]float64
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(runCompare(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		os.Exit(runGenerate(os.Args[2:]))
+	}
 	flag.Parse()
+	parseQuantileGrids()
+	checkResultsMode()
 
 	mustBeDir(*outputDir)
 
 	var err error
 	var hist hdrbench.Histogram
 	histograms := make(HistogramList, 0)
-	if hist, err = hdrbench.NewPreceiseHist(); err != nil {
+	if *spillLimit > 0 {
+		hist, err = hdrbench.NewSpillingPreciseHist(*spillDir, *spillLimit)
+	} else {
+		hist, err = hdrbench.NewPreceiseHist()
+	}
+	if err != nil {
 		glog.Fatal("Unable to create precise histo")
 	}
+	if closer, ok := hist.(io.Closer); ok {
+		// removes spilled values
+		defer closer.Close()
+	}
 	histograms = append(histograms, hist)
 	glog.Info("Adding ", hist.Name(), " histogram")
 	if hist, err = hdrbench.NewHdrHist(0, 1000, 2, *intScale); err != nil {
@@ -51,58 +84,219 @@ func main() {
 	}
 	histograms = append(histograms, hist)
 	glog.Info("Adding ", hist.Name(), " histogram")
-	if hist, err = hdrbench.NewCircosusHist(); err != nil {
-		glog.Fatal("Unable to create Circonus histor")
+	if hist, err = hdrbench.NewCirconusHist(*circonusDigits, *circonusMaxBins); err != nil {
+		glog.Fatal("Unable to create Circonus histo: ", err)
 	}
 	histograms = append(histograms, hist)
 	glog.Info("Adding ", hist.Name(), " histogram")
+	setQuantileMethod(histograms)
 
-	for singals := *minSignals; singals <= (*maxSignals); singals *= *signalMultiplier {
-		quantilesDiff := make(quantileDiffHistory, *iterationsCount)
-		glog.Info("Caclulating errors for ", singals, " signals over ",
-			*iterationsCount, " iterations")
-		glog.Info("  each signal will recieve ", *datapointsCount, " datapoint per iteration")
-		rnd := rand.New(rand.NewSource(*randSeed))
-		datasets := hdrbench.NewLatencyDatasets(
-			rnd, (*datapointsCount)*(*iterationsCount), singals, *outliers)
-		if *drawDatasets {
-			_ = hdrbench.PlotDatasets(datasets,
-				path.Join(*outputDir, "signals"+strconv.Itoa(singals)+".png"),
-				*datapointsCount)
-		}
-		for iter := 0; iter < *iterationsCount; iter++ {
-			iterationQuantiles := make([][]float64, len(histograms))
-			quantilesDiff[iter] = make([][]float64, len(histograms))
-			for hi, hist := range histograms {
-				hist.Reset()
-				err := hist.RecordValues(
-					datasets, iter*(*datapointsCount), (iter+1)*(*datapointsCount))
-				if err != nil {
-					glog.Fatalf("Failed to record values iter %d hist %s",
-						iter, histograms[iter].Name())
-				}
-				iterationQuantiles[hi], err = hist.Quantiles(AllQuantiles)
+	if *coordinatedOmission {
+		runCoordinatedOmission(histograms)
+		return
+	}
+	if *skew {
+		runSkew(histograms)
+		return
+	}
+	if *rollup {
+		runRollups(histograms)
+		return
+	}
+	if *sweep {
+		runSweep()
+		return
+	}
+
+	heatmap := newErrorHeatmap(len(histograms))
+	if *streamInput != "" {
+		runStreamInput(histograms, heatmap)
+	} else if *inputFile != "" || *loadFile != "" {
+		var datasets []*hdrbench.Dataset
+		if *loadFile != "" {
+			datasets = loadArchive()
+		} else {
+			datasets = loadInput()
+		}
+		length := 0
+		for _, dataset := range datasets {
+			if dataset.Len() > length {
+				length = dataset.Len()
+			}
+		}
+		iterations := (length + *datapointsCount - 1) / *datapointsCount
+		runIterations(histograms, datasets, recordWindows(datasets, iterations), len(datasets),
+			iterations, heatmap, nil, nil)
+	} else {
+		for singals := *minSignals; singals <= (*maxSignals); singals *= *signalMultiplier {
+			rnd := rand.New(rand.NewSource(*randSeed))
+			if *arrivals != "" {
+				runTimeWindows(histograms, rnd, singals, heatmap)
+				continue
+			}
+			if *stream {
+				runStream(histograms, rnd, singals, heatmap)
+				continue
+			}
+			if *repeat > 1 {
+				// every run generates its own datasets
+				runRepeats(histograms, singals)
+				continue
+			}
+			datasets := hdrbench.NewLatencyDatasets(
+				rnd, (*datapointsCount)*(*iterationsCount), singals, *outliers)
+			datasets, changed := applyWorkload(datasets, *iterationsCount, *randSeed)
+			if *topology != "" {
+				runTopology(histograms, datasets, singals, *iterationsCount)
+				continue
+			}
+			runIterations(histograms, datasets, recordWindows(datasets, *iterationsCount), singals,
+				*iterationsCount, heatmap, changed, nil)
+		}
+	}
+	if *resultsFile != "" {
+		writeResults(*resultsFile)
+	}
+	if *drawHeatmap {
+		// start from 1 due of histograms[0] is alwasy Precise
+		for hi := 1; hi < len(histograms); hi++ {
+			err := plotErrorHeatmap(histograms[hi], heatmap.signals, AllQuantiles, heatmap.errors[hi])
+			if err != nil {
+				glog.Error("Failed to draw errors heatmap: ", err)
+			}
+		}
+	}
+}
+
+// runIterations reports quantiles errors of every histogram against
+// the precise one, changed marks iterations with workload change points.
+// Streamed values have no datasets, summary of them is reported instead.
+func runIterations(histograms HistogramList, datasets []*hdrbench.Dataset, record windowRecorder,
+	singals int, iterations int, heatmap *errorHeatmap, changed []bool, summary *hdrbench.Summary) {
+
+	glog.Info("Caclulating errors for ", singals, " signals over ",
+		iterations, " iterations")
+	glog.Info("  each signal will recieve ", *datapointsCount, " datapoint per iteration")
+	if *drawDatasets && datasets != nil {
+		_ = hdrbench.PlotDatasets(datasets,
+			path.Join(*outputDir, "signals"+strconv.Itoa(singals)+".png"),
+			*datapointsCount, *gnuplotScripts)
+	}
+	var hlog *hdrbench.HlogWriter
+	if *writeHlog {
+		fname := path.Join(*outputDir, "histograms"+strconv.Itoa(singals)+".hlog")
+		f, err := os.Create(fname)
+		if err != nil {
+			glog.Fatal("Unable to create ", fname, ": ", err)
+		}
+		defer f.Close()
+		hlog = hdrbench.NewHlogWriter(f, time.Now(), 3, *intScale)
+	}
+	metricSet, err := metrics.Parse(*metricNames)
+	if err != nil {
+		glog.Fatal("Invalid -metrics: ", err)
+	}
+	quantilesDiff, quantilesErrors, iterationQuantiles, metricsDiff := measureIterations(
+		histograms, record, iterations, hlog, metricSet)
+	glog.Info("Calculated ", singals, " signals")
+	for _, histogram := range histograms {
+		glog.Info("Histogram ", histogram.Name(), " uses ", histogram.UsedMem(), " bytes")
+	}
+	if datasets != nil {
+		reportShape(singals, hdrbench.DatasetsShape(datasets))
+	} else if summary != nil {
+		reportMoments(singals, hdrbench.SummaryShape(*summary))
+	}
+	reportQuantilesErrors(singals, histograms, quantilesDiff, changed)
+	for mi, metric := range metricSet {
+		reportMetricErrors(metric, histograms, metricsDiff[mi])
+	}
+	if *resultsFile != "" {
+		addResults(singals, histograms, quantilesDiff)
+	}
+	if *drawPercentiles && iterationQuantiles != nil {
+		// distribution of the last iteration
+		if err := plotPercentiles(singals, histograms, AllQuantiles, iterationQuantiles); err != nil {
+			glog.Error("Failed to draw percentiles distribution: ", err)
+		}
+	}
+	heatmap.add(singals, quantilesErrors)
+}
+
+// measureIterations records windows of datasets into every histogram with
+// record and returns sorted and unsorted relative errors of quantiles against
+// the precise histogram along with quantiles of the last iteration
+// and sorted errors of every metric of metricSet.
+// Every iteration is written to hlog if it isn't nil.
+func measureIterations(histograms HistogramList, record windowRecorder,
+	iterations int, hlog *hdrbench.HlogWriter, metricSet []metrics.Metric) (
+	quantileDiffHistory, quantileDiffHistory, [][]float64, []quantileDiffHistory) {
+
+	quantilesDiff := make(quantileDiffHistory, 0)
+	quantilesErrors := make(quantileDiffHistory, 0)
+	metricsDiff := make([]quantileDiffHistory, len(metricSet))
+	var iterationQuantiles [][]float64
+iterationsLoop:
+	for iter := 0; iter < iterations; iter++ {
+		quantiles := make([][]float64, len(histograms))
+		for hi, hist := range histograms {
+			hist.Reset()
+			err := record(hist, iter)
+			if err == io.EOF {
+				// streamed values are over
+				break iterationsLoop
+			}
+			if err != nil {
+				glog.Fatalf("Failed to record values iter %d hist %s",
+					iter, hist.Name())
+			}
+			quantiles[hi], err = hist.Quantiles(AllQuantiles)
+			if err != nil {
+				glog.Fatalf("Failed to calculate quantiles at iter %d hist %s",
+					iter, hist.Name())
+			}
+			if hlog != nil {
+				// every iteration is logged as a second long interval
+				err = hlog.WriteInterval(hist.Name(), float64(iter), 1.0, hist.Buckets())
 				if err != nil {
-					glog.Fatalf("Failed to calculate quantiles at iter %d hist %s",
-						iter, histograms[iter].Name())
+					glog.Fatalf("Failed to write histogram at iter %d hist %s: %v",
+						iter, hist.Name(), err)
 				}
 			}
+		}
+		iterationQuantiles = quantiles
+		quantilesDiff = append(quantilesDiff, make([][]float64, len(histograms)))
+		quantilesErrors = append(quantilesErrors, make([][]float64, len(histograms)))
+		for hi := 1; hi < len(histograms); hi++ {
+			quantilesErrors[iter][hi] = hdrbench.DiffRelative(
+				iterationQuantiles[0],
+				iterationQuantiles[hi])
+			quantilesDiff[iter][hi] = make([]float64, len(quantilesErrors[iter][hi]))
+			copy(quantilesDiff[iter][hi], quantilesErrors[iter][hi])
+			quantilesDiff[iter][hi] = hdrbench.QSortFloat(quantilesDiff[iter][hi])
+		}
+		if len(metricSet) == 0 {
+			continue
+		}
+		sorted, err := hdrbench.SortedValues(histograms[0])
+		if err != nil {
+			glog.Fatal(err)
+		}
+		// quantiles of Precise are the reference, so metrics and errors
+		// above share the definition of quantiles
+		for mi, metric := range metricSet {
+			metricsDiff[mi] = append(metricsDiff[mi], make([][]float64, len(histograms)))
 			for hi := 1; hi < len(histograms); hi++ {
-				quantilesDiff[iter][hi] = hdrbench.DiffRelative(
-					iterationQuantiles[0],
-					iterationQuantiles[hi])
-				quantilesDiff[iter][hi] = hdrbench.QSortFloat(quantilesDiff[iter][hi])
+				metricsDiff[mi][iter][hi] = hdrbench.QSortFloat(
+					metric.Compute(sorted, AllQuantiles, iterationQuantiles[0], iterationQuantiles[hi]))
 			}
 		}
-		glog.Info("Calculated ", singals, " signals")
-		for _, histogram := range histograms {
-			glog.Info("Histogram ", histogram.Name(), " uses ", histogram.UsedMem(), " bytes")
-		}
-		reportQuantilesErrors(singals, histograms, quantilesDiff)
 	}
+	return quantilesDiff, quantilesErrors, iterationQuantiles, metricsDiff
 }
 
-func reportQuantilesErrors(signals int, histograms HistogramList, quantilesDiff quantileDiffHistory) {
+func reportQuantilesErrors(signals int, histograms HistogramList, quantilesDiff quantileDiffHistory,
+	changed []bool) {
 	glog.Info("Generating report")
 
 	w := new(tabwriter.Writer)
@@ -111,10 +305,10 @@ func reportQuantilesErrors(signals int, histograms HistogramList, quantilesDiff
 	// start from 1 due of histograms[0] is alwasy Precise
 	for hIdx := 1; hIdx < len(histograms); hIdx++ {
 		histogram := histograms[hIdx]
-		fmt.Fprintln(w, histogram.Name())
+		fmt.Fprintf(w, "%s\t%d bytes\n", histogram.Name(), histogram.UsedMem())
 		// print quantiles header
 		for i := range errorQuantiles {
-			fmt.Fprintf(w, "\t%0.2f", errorQuantiles[i])
+			fmt.Fprintf(w, "\t%v", errorQuantiles[i])
 		}
 		fmt.Fprintln(w)
 		graph := make(map[float64][]float64)
@@ -122,15 +316,40 @@ func reportQuantilesErrors(signals int, histograms HistogramList, quantilesDiff
 			// making per quantile with size of number of iterations
 			graph[qval] = make([]float64, len(quantilesDiff))
 		}
+		// mean errors of iterations with and without change points
+		changedErrors := make([]float64, len(errorQuantiles))
+		steadyErrors := make([]float64, len(errorQuantiles))
+		changes := 0
 		for iter := range quantilesDiff {
-			fmt.Fprintf(w, "%d", iter+1)
+			mark := ""
+			sums := steadyErrors
+			if changed != nil && changed[iter] {
+				mark = "*"
+				sums = changedErrors
+				changes++
+			}
+			fmt.Fprintf(w, "%d%s", iter+1, mark)
 			errorQ := hdrbench.Quantiles(quantilesDiff[iter][hIdx], errorQuantiles)
 			for i := range errorQuantiles {
 				fmt.Fprintf(w, "\t%.2f%%", errorQ[i]*100)
 				graph[errorQuantiles[i]][iter] = errorQ[i] * 100
+				sums[i] += errorQ[i]
 			}
 			fmt.Fprintln(w)
 		}
+		if changes > 0 && changes < len(quantilesDiff) {
+			for _, row := range []struct {
+				name   string
+				errors []float64
+				iters  int
+			}{{"changed", changedErrors, changes}, {"steady", steadyErrors, len(quantilesDiff) - changes}} {
+				fmt.Fprint(w, row.name)
+				for i := range errorQuantiles {
+					fmt.Fprintf(w, "\t%.2f%%", row.errors[i]/float64(row.iters)*100)
+				}
+				fmt.Fprintln(w)
+			}
+		}
 		if *drawErrors {
 			// don't draw more then 300 graphs, gnuplot wouldn't be happy
 			_ = plotErrors(signals, histogram, graph)
@@ -139,17 +358,50 @@ func reportQuantilesErrors(signals int, histograms HistogramList, quantilesDiff
 	w.Flush()
 }
 
+// reportMetricErrors prints errors of every iteration in metric,
+// summarized by errorQuantiles for pointwise metrics.
+func reportMetricErrors(metric metrics.Metric, histograms HistogramList, metricDiff quantileDiffHistory) {
+	scale, unit := 1.0, ""
+	if metric.Percent {
+		scale, unit = 100.0, "%"
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	// start from 1 due of histograms[0] is alwasy Precise
+	for hIdx := 1; hIdx < len(histograms); hIdx++ {
+		fmt.Fprintf(w, "%s\t%s error\n", histograms[hIdx].Name(), metric.Name)
+		if metric.Pointwise {
+			for i := range errorQuantiles {
+				fmt.Fprintf(w, "\t%v", errorQuantiles[i])
+			}
+			fmt.Fprintln(w)
+		}
+		for iter := range metricDiff {
+			fmt.Fprintf(w, "%d", iter+1)
+			errors := metricDiff[iter][hIdx]
+			if metric.Pointwise {
+				errors = hdrbench.Quantiles(errors, errorQuantiles)
+			}
+			for _, e := range errors {
+				fmt.Fprintf(w, "\t%.4g%s", e*scale, unit)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	w.Flush()
+}
+
 func plotErrors(signals int, hist hdrbench.Histogram, graph map[float64][]float64) error {
-	p, err := gnuplot.NewPlotter("", false, false)
+	fname := path.Join(*outputDir, hist.Name()+strconv.Itoa(signals)+".png")
+
+	p, output, err := hdrbench.NewPlotter(fname, *gnuplotScripts)
 	if err != nil {
 		return err
 	}
 	defer p.Close()
 
-	fname := path.Join(*outputDir, hist.Name()+strconv.Itoa(signals)+".png")
-
 	_ = p.SetStyle("lines")
-	p.CheckedCmd("set terminal png")
+	p.CheckedCmd("set terminal unknown")
 	p.CheckedCmd("set title 'Approximated quantiles errors'")
 	for k, v := range graph {
 		err = p.PlotX(v, fmt.Sprintf("P%02.0f", k*100))
@@ -157,39 +409,68 @@ func plotErrors(signals int, hist hdrbench.Histogram, graph map[float64][]float6
 			return err
 		}
 	}
-	p.CheckedCmd("set output '" + fname + "'")
-	p.CheckedCmd("replot")
+	hdrbench.RenderPlot(p, "png", output)
 
 	p.CheckedCmd("q")
 	return nil
 }
 
-var errorQuantiles = []float64{0.1, 0.5, 0.97, 0.99}
+var quantileGrid = flag.String("quantiles", "uniform:0.001",
+	"Grid of quantiles errors are measured at: comma separated quantiles, "+
+		"uniform:<step> or nines:<max nines>[:<per nine>], grids can be joined with '+'")
+var errorQuantileGrid = flag.String("error-quantiles", "0.1,0.5,0.97,0.99",
+	"Quantiles of errors distribution over the -quantiles grid to report, same format")
 
-const (
-	// 100/QuantilesCount will be precision. With 1000 it would be quantiles with 0.1 step
-	QuantilesCount = 1000
-)
+// errorQuantiles summarize distribution of errors over AllQuantiles.
+var errorQuantiles []float64
+
+// AllQuantiles is the grid quantiles errors are measured at.
+var AllQuantiles []float64
+
+var quantileMethod = flag.String("quantile-method", "native",
+	"Definition of quantiles for histograms supporting it: native, Hyndman-Fan type 1-9 "+
+		"or its name (inverted-cdf, linear, median-unbiased, ...)")
 
-var AllQuantiles = make([]float64, QuantilesCount)
+// setQuantileMethod makes histograms estimate quantiles by -quantile-method,
+// histograms not supporting it keep their native definition.
+func setQuantileMethod(histograms HistogramList) {
+	method := parseQuantileMethod()
+	for _, hist := range histograms {
+		if err := hdrbench.SetQuantileMethod(hist, method); err != nil {
+			glog.Warning(err, ", using native quantiles")
+		}
+	}
+}
+
+func parseQuantileMethod() hdrbench.QuantileMethod {
+	method, err := hdrbench.ParseQuantileMethod(*quantileMethod)
+	if err != nil {
+		glog.Fatal("Invalid -quantile-method: ", err)
+	}
+	return method
+}
 
-func init() {
-	for i := 1; i <= len(AllQuantiles); i++ {
-		AllQuantiles[i-1] = float64(i) / float64(QuantilesCount) // every .1 pct
+func parseQuantileGrids() {
+	var err error
+	if AllQuantiles, err = hdrbench.ParseQuantiles(*quantileGrid); err != nil {
+		glog.Fatal("Invalid -quantiles: ", err)
+	}
+	if errorQuantiles, err = hdrbench.ParseQuantiles(*errorQuantileGrid); err != nil {
+		glog.Fatal("Invalid -error-quantiles: ", err)
 	}
 }
 
 func mustBeDir(dirname string) {
 	if stat, err := os.Stat(dirname); err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(dirname, 0777)
-			if err != nil {
-				glog.Fatal("Unable to create directory ", dirname, err)
-			}
+		if !os.IsNotExist(err) {
+			glog.Fatal("Unable to access directory ", dirname, err)
 		}
-		if !stat.IsDir() {
-			glog.Fatalf("%s exists, but not a directory", *outputDir)
+		err = os.MkdirAll(dirname, 0777)
+		if err != nil {
+			glog.Fatal("Unable to create directory ", dirname, err)
 		}
+	} else if !stat.IsDir() {
+		glog.Fatalf("%s exists, but not a directory", dirname)
 	}
 	glog.Info("Using workdir ", dirname)
 }
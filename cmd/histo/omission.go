@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var coordinatedOmission = flag.Bool("co", false,
+	"Simulate closed-loop load generator with stalls and report coordinated omission errors")
+var coInterval = flag.Float64("co-interval", 10.0, "Expected interval between requests of a signal")
+var coStallProb = flag.Float64("co-stall-prob", 0.001, "Probability of a request to stall")
+var coStall = flag.Float64("co-stall", 1000.0, "Maximum stall duration, stalls are at least half of it")
+
+// coQuantiles are latency quantiles reported for coordinated omission.
+var coQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// runCoordinatedOmission records stalled workload with and without
+// correction and reports errors against latencies an open-loop load generator
+// would have observed.
+func runCoordinatedOmission(histograms HistogramList) {
+	rnd := rand.New(rand.NewSource(*randSeed))
+	observed, expected := hdrbench.NewStalledDatasets(
+		rnd, (*datapointsCount)*(*iterationsCount), *minSignals,
+		*coInterval, *coStallProb, *coStall/2, *coStall)
+	length := 0
+	for _, dataset := range expected {
+		if dataset.Len() > length {
+			length = dataset.Len()
+		}
+	}
+
+	reference := histograms[0]
+	reference.Reset()
+	if err := reference.RecordValues(expected, 0, length); err != nil {
+		glog.Fatal("Failed to record expected values: ", err)
+	}
+	expectedQ, err := reference.Quantiles(coQuantiles)
+	if err != nil {
+		glog.Fatal("Failed to calculate expected quantiles: ", err)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprint(w, "Expected")
+	for i := range coQuantiles {
+		fmt.Fprintf(w, "\tP%v", coQuantiles[i]*100)
+	}
+	fmt.Fprintln(w)
+	for i := range expectedQ {
+		fmt.Fprintf(w, "\t%.2f", expectedQ[i])
+	}
+	fmt.Fprintln(w)
+	for _, hist := range histograms {
+		fmt.Fprintln(w, hist.Name())
+		for _, interval := range []float64{0, *coInterval} {
+			hist.Reset()
+			if err := hist.RecordCorrectedValues(observed, 0, length, interval); err != nil {
+				glog.Fatalf("Failed to record values hist %s: %v", hist.Name(), err)
+			}
+			histQ, err := hist.Quantiles(coQuantiles)
+			if err != nil {
+				glog.Fatalf("Failed to calculate quantiles hist %s: %v", hist.Name(), err)
+			}
+			if interval == 0 {
+				fmt.Fprint(w, "uncorrected")
+			} else {
+				fmt.Fprint(w, "corrected")
+			}
+			for _, diff := range hdrbench.DiffRelative(expectedQ, histQ) {
+				fmt.Fprintf(w, "\t%.2f%%", diff*100)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/octo47/hdrbench"
+)
+
+// percentileTics are labels of the percentile distribution x-axis.
+var percentileTics = []float64{0.0, 0.9, 0.99, 0.999, 0.9999, 0.99999}
+
+// plotPercentiles draws the classic HdrHistogram percentile distribution
+// chart: value against percentile on log scaled 1/(1-q) axis.
+// Every histogram is drawn over the same axes, so approximated curves can be
+// compared to the Precise one.
+func plotPercentiles(signals int, histograms HistogramList, quantiles []float64,
+	values [][]float64) error {
+	fname := path.Join(*outputDir, "percentiles"+strconv.Itoa(signals)+".png")
+
+	p, output, err := hdrbench.NewPlotter(fname, *gnuplotScripts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	// q == 1.0 is infinitely far on the 1/(1-q) axis
+	x := make([]float64, 0, len(quantiles))
+	maxX := 1.0
+	for _, q := range quantiles {
+		if q >= 1.0 {
+			break
+		}
+		x = append(x, 1/(1-q))
+		maxX = math.Max(maxX, 1/(1-q))
+	}
+	tics := make([]string, 0, len(percentileTics))
+	for _, q := range percentileTics {
+		if 1/(1-q) > maxX {
+			break
+		}
+		label := strconv.FormatFloat(q*100, 'f', -1, 64) + "%"
+		tics = append(tics, fmt.Sprintf("\"%s\" %v", label, 1/(1-q)))
+	}
+
+	_ = p.SetStyle("lines")
+	p.CheckedCmd("set terminal unknown")
+	p.CheckedCmd("set title 'Latency by percentile distribution, %d signals'", signals)
+	p.CheckedCmd("set logscale x")
+	p.CheckedCmd("set xtics (%s)", strings.Join(tics, ", "))
+	p.CheckedCmd("set key top left")
+	p.CheckedCmd("set grid")
+	if err := p.SetLabels("Percentile", "Value"); err != nil {
+		return err
+	}
+	for hi, hist := range histograms {
+		if err := p.PlotXY(x, values[hi], hist.Name()); err != nil {
+			return err
+		}
+	}
+	hdrbench.RenderPlot(p, "png size 1280,800", output)
+
+	p.CheckedCmd("q")
+	return nil
+}
+
+// heatmapTics are quantiles labeled on the heatmap x-axis.
+var heatmapTics = []float64{0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999}
+
+// errorHeatmap accumulates median relative error per quantile
+// over the sweep of signal counts.
+type errorHeatmap struct {
+	signals []int
+	// histogram -> signals -> quantile
+	errors [][][]float64
+}
+
+func newErrorHeatmap(histograms int) *errorHeatmap {
+	return &errorHeatmap{
+		errors: make([][][]float64, histograms),
+	}
+}
+
+// add stores median over iterations of per quantile errors,
+// quantilesErrors is indexed as iteration -> histogram -> quantile.
+func (hm *errorHeatmap) add(signals int, quantilesErrors quantileDiffHistory) {
+	hm.signals = append(hm.signals, signals)
+	for hi := range hm.errors {
+		if len(quantilesErrors) == 0 || quantilesErrors[0][hi] == nil {
+			continue
+		}
+		row := make([]float64, len(quantilesErrors[0][hi]))
+		perIter := make([]float64, len(quantilesErrors))
+		for qi := range row {
+			for iter := range quantilesErrors {
+				perIter[iter] = quantilesErrors[iter][hi][qi]
+			}
+			row[qi] = hdrbench.Median(hdrbench.QSortFloat(perIter)) * 100
+		}
+		hm.errors[hi] = append(hm.errors[hi], row)
+	}
+}
+
+// plotErrorHeatmap draws median error of hist by quantile (x) and
+// number of signals (y).
+func plotErrorHeatmap(hist hdrbench.Histogram, signals []int, quantiles []float64,
+	errors [][]float64) error {
+	fname := path.Join(*outputDir, "heatmap"+hist.Name()+".png")
+
+	p, output, err := hdrbench.NewPlotter(fname, *gnuplotScripts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	xtics := make([]string, 0, len(heatmapTics))
+	for _, q := range heatmapTics {
+		for qi := range quantiles {
+			if quantiles[qi] >= q {
+				xtics = append(xtics, fmt.Sprintf("\"P%v\" %d",
+					strconv.FormatFloat(q*100, 'f', -1, 64), qi))
+				break
+			}
+		}
+	}
+	ytics := make([]string, len(signals))
+	for si, s := range signals {
+		ytics[si] = fmt.Sprintf("\"%d\" %d", s, si)
+	}
+
+	p.CheckedCmd("set terminal unknown")
+	p.CheckedCmd("set title '%s median relative error, %%'", hist.Name())
+	p.CheckedCmd("set xtics (%s)", strings.Join(xtics, ", "))
+	p.CheckedCmd("set ytics (%s)", strings.Join(ytics, ", "))
+	p.CheckedCmd("set xrange [-0.5:%f]", float64(len(quantiles))-0.5)
+	p.CheckedCmd("set yrange [-0.5:%f]", float64(len(signals))-0.5)
+	p.CheckedCmd("set palette rgb 33,13,10")
+	if err := p.SetLabels("Quantile", "Signals"); err != nil {
+		return err
+	}
+	if err := p.PlotMatrix(errors, ""); err != nil {
+		return err
+	}
+	hdrbench.RenderPlot(p, "png size 1280,800", output)
+
+	p.CheckedCmd("q")
+	return nil
+}
+
+// paretoQuantiles are quantiles which errors are drawn against memory.
+var paretoQuantiles = []float64{0.99, 0.999}
+
+// plotPareto draws errors of every swept configuration against its memory
+// usage, non-dominated configurations are connected and labeled.
+func plotPareto(signals int, quantiles []float64, points []hdrbench.SweepPoint) error {
+	fname := path.Join(*outputDir, "pareto"+strconv.Itoa(signals)+".png")
+
+	p, output, err := hdrbench.NewPlotter(fname, *gnuplotScripts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	p.CheckedCmd("set terminal unknown")
+	p.CheckedCmd("set title 'Relative error by used memory, %d signals'", signals)
+	p.CheckedCmd("set logscale x")
+	p.CheckedCmd("set key top right")
+	p.CheckedCmd("set grid")
+	if err := p.SetLabels("Memory, bytes", "Error, %%"); err != nil {
+		return err
+	}
+	for _, q := range paretoQuantiles {
+		qi := -1
+		for i := range quantiles {
+			if quantiles[i] == q {
+				qi = i
+			}
+		}
+		if qi < 0 {
+			continue
+		}
+		name := "P" + strconv.FormatFloat(q*100, 'f', -1, 64)
+		mem := make([]float64, len(points))
+		errors := make([]float64, len(points))
+		for i, point := range points {
+			mem[i] = float64(point.UsedMem)
+			errors[i] = point.Errors[qi] * 100
+		}
+		_ = p.SetStyle("points")
+		if err := p.PlotXY(mem, errors, name); err != nil {
+			return err
+		}
+		frontier := hdrbench.ParetoFrontier(points, qi)
+		frontierMem := make([]float64, len(frontier))
+		frontierErrors := make([]float64, len(frontier))
+		for i, pi := range frontier {
+			frontierMem[i] = mem[pi]
+			frontierErrors[i] = errors[pi]
+			p.CheckedCmd("set label \"%s\" at %v,%v offset 1,1 font \",8\"",
+				points[pi].Config, mem[pi], errors[pi])
+		}
+		_ = p.SetStyle("lines")
+		if err := p.PlotXY(frontierMem, frontierErrors, name+" frontier"); err != nil {
+			return err
+		}
+	}
+	hdrbench.RenderPlot(p, "png size 1280,800", output)
+
+	p.CheckedCmd("q")
+	return nil
+}
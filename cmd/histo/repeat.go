@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var repeat = flag.Int("repeat", 1,
+	"Rerun generated signals with N seeds derived from -rand and report mean, stddev "+
+		"and bootstrap confidence intervals of errors at -repeat-quantiles")
+var repeatQuantiles = flag.String("repeat-quantiles", "0.5,0.9,0.99,0.999",
+	"Comma separated latency quantiles reported with -repeat, nearest quantiles of -quantiles are used")
+var bootstrapResamples = flag.Int("bootstrap", 1000, "Number of bootstrap resamples")
+var confidence = flag.Float64("confidence", 0.95, "Confidence level of bootstrap intervals")
+
+// repeatSeeds derives seeds of repeated runs, the first run uses seed itself.
+func repeatSeeds(seed int64, n int) []int64 {
+	rnd := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, n)
+	seeds[0] = seed
+	for i := 1; i < n; i++ {
+		seeds[i] = rnd.Int63()
+	}
+	return seeds
+}
+
+// runRepeats measures errors of singals signals generated with every
+// derived seed, workloads are applied with the seed of the run too.
+// Error of a run at a quantile of AllQuantiles is a mean over iterations,
+// so every backend gets a sample of *repeat errors per quantile.
+func runRepeats(histograms HistogramList, singals int) {
+	seeds := repeatSeeds(*randSeed, *repeat)
+	glog.Info("Repeating ", singals, " signals with ", len(seeds), " seeds")
+	// histogram -> position in AllQuantiles -> run
+	runErrors := make([][][]float64, len(histograms))
+	for hi := range runErrors {
+		runErrors[hi] = make([][]float64, len(AllQuantiles))
+		for qi := range AllQuantiles {
+			runErrors[hi][qi] = make([]float64, len(seeds))
+		}
+	}
+	for run, seed := range seeds {
+		rnd := rand.New(rand.NewSource(seed))
+		datasets := hdrbench.NewLatencyDatasets(
+			rnd, (*datapointsCount)*(*iterationsCount), singals, *outliers)
+		datasets, _ = applyWorkload(datasets, *iterationsCount, seed)
+		_, quantilesErrors, _, _ := measureIterations(
+			histograms, indexWindows(datasets), *iterationsCount, nil, nil)
+		for hi := 1; hi < len(histograms); hi++ {
+			for iter := range quantilesErrors {
+				for qi, diff := range quantilesErrors[iter][hi] {
+					runErrors[hi][qi][run] += diff / float64(len(quantilesErrors))
+				}
+			}
+		}
+	}
+	reportRepeatedErrors(singals, histograms, runErrors)
+}
+
+// nearestQuantiles returns positions of AllQuantiles nearest to quantiles.
+func nearestQuantiles(quantiles []float64) []int {
+	positions := make([]int, len(quantiles))
+	for i, q := range quantiles {
+		for qi := range AllQuantiles {
+			if math.Abs(AllQuantiles[qi]-q) < math.Abs(AllQuantiles[positions[i]]-q) {
+				positions[i] = qi
+			}
+		}
+	}
+	return positions
+}
+
+func reportRepeatedErrors(signals int, histograms HistogramList, runErrors [][][]float64) {
+	rnd := rand.New(rand.NewSource(*randSeed))
+	positions := nearestQuantiles(parseFloats(*repeatQuantiles))
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	// start from 1 due of histograms[0] is alwasy Precise
+	for hIdx := 1; hIdx < len(histograms); hIdx++ {
+		fmt.Fprintln(w, histograms[hIdx].Name(), signals, "signals", *repeat, "runs")
+		fmt.Fprintf(w, "\tmean\tstddev\t%.0f%% CI\n", *confidence*100)
+		for _, qi := range positions {
+			errors := runErrors[hIdx][qi]
+			mean := hdrbench.Mean(errors)
+			lower, upper := hdrbench.Bootstrap(rnd, errors, hdrbench.Mean,
+				*bootstrapResamples, *confidence)
+			fmt.Fprintf(w, "P%v\t%.2f%%\t%.2f%%\t%.2f..%.2f%%\n", AllQuantiles[qi]*100,
+				mean*100, hdrbench.StdDev(errors, mean)*100, lower*100, upper*100)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var rollup = flag.Bool("rollup", false,
+	"Record signals into per second histograms, roll them up and compare quantiles "+
+		"of every resolution with exact ones")
+var rollupRate = flag.Int("rollup-rate", 1, "Datapoints per second of a signal")
+var rollupLevels = flag.String("rollup-levels", "60,60",
+	"Comma separated number of windows merged into a window of the next resolution")
+var rollupWindows = flag.Int("rollup-windows", 1, "Number of windows of the coarsest resolution")
+
+// rollupQuantiles are quantiles reported for rolled up histograms.
+var rollupQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+func runRollups(histograms HistogramList) {
+	if *rollupRate < 1 {
+		glog.Fatalf("Invalid -rollup-rate %d, at least 1 datapoint per second is expected", *rollupRate)
+	}
+	factors := parseFanOut(*rollupLevels)
+	method := parseQuantileMethod()
+	seconds := *rollupWindows
+	for _, factor := range factors {
+		seconds *= factor
+	}
+	for singals := *minSignals; singals <= (*maxSignals); singals *= *signalMultiplier {
+		glog.Info("Rolling up ", seconds, " seconds of ", singals, " signals")
+		rnd := rand.New(rand.NewSource(*randSeed))
+		datasets := hdrbench.NewLatencyDatasets(rnd, seconds*(*rollupRate), singals, *outliers)
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+		// histograms[0] is Precise, its rollups are exact
+		for _, hist := range histograms[1:] {
+			resolutions, err := hdrbench.Rollup(
+				hist, datasets, *rollupRate, factors, rollupQuantiles, method)
+			if err != nil {
+				glog.Fatalf("Failed to roll up hist %s: %v", hist.Name(), err)
+			}
+			fmt.Fprintln(w, hist.Name(), "mean (max) errors")
+			for i := range rollupQuantiles {
+				fmt.Fprintf(w, "\tP%v", rollupQuantiles[i]*100)
+			}
+			fmt.Fprintln(w)
+			for _, resolution := range resolutions {
+				fmt.Fprint(w, time.Duration(resolution.Seconds)*time.Second)
+				for qi := range rollupQuantiles {
+					sum, max := 0.0, 0.0
+					for _, errors := range resolution.Errors {
+						sum += errors[qi]
+						max = math.Max(max, errors[qi])
+					}
+					fmt.Fprintf(w, "\t%.2f%% (%.2f%%)",
+						sum/float64(len(resolution.Errors))*100, max*100)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var sampleRate = flag.Float64("sample-rate", 1.0,
+	"Sample values of every iteration with this rate, kept values weight 1/rate "+
+		"like in sampled traces and are recorded weighted by every histogram")
+
+// recordWindows records iterations of datasets, sampled if -sample-rate
+// is below 1.
+func recordWindows(datasets []*hdrbench.Dataset, iterations int) windowRecorder {
+	if *sampleRate >= 1.0 {
+		return indexWindows(datasets)
+	}
+	if !(*sampleRate > 0) {
+		glog.Fatal("Invalid -sample-rate ", *sampleRate)
+	}
+	if *metricNames != "" {
+		glog.Fatal("-metrics can't be calculated for weighted values of -sample-rate")
+	}
+	rnd := rand.New(rand.NewSource(*randSeed))
+	sampled := make([][]*hdrbench.Dataset, iterations)
+	for iter := range sampled {
+		sampled[iter] = hdrbench.SampleDatasets(rnd, datasets,
+			iter*(*datapointsCount), (iter+1)*(*datapointsCount), *sampleRate)
+	}
+	glog.Info("Sampling values with rate ", *sampleRate)
+	return func(hist hdrbench.Histogram, iter int) error {
+		return hist.RecordValues(sampled[iter], 0, *datapointsCount)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/octo47/hdrbench"
+)
+
+// workloadName describes where signals come from.
+func workloadName() string {
+	switch {
+	case *streamInput != "":
+		return *streamInput
+	case *loadFile != "":
+		return *loadFile
+	case *inputFile != "":
+		return *inputFile
+	case *workload != "":
+		return *workload
+	}
+	return "default"
+}
+
+// reportShape prints shape of values of all signals, so errors of
+// backends could be told apart by the workload.
+func reportShape(signals int, shape hdrbench.Shape) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprintf(w, "Workload %s, %d signals, %d values\n", workloadName(), signals, shape.Count)
+	fmt.Fprintln(w, "\tMean\tStdDev\tMin\tMax\tMedian\tMAD\tTrimmed\tWinsor\tSkew\tKurt\tTail")
+	fmt.Fprintf(w, "\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+		shape.Mean, shape.StdDev, shape.Min, shape.Max, shape.Median, shape.MAD,
+		shape.TrimmedMean, shape.WinsorizedMean, shape.Skewness, shape.Kurtosis, shape.TailIndex)
+	w.Flush()
+}
+
+// reportMoments prints the part of shape known from summary of streamed
+// values, robust statistics need all values at once.
+func reportMoments(signals int, shape hdrbench.Shape) {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprintf(w, "Workload %s, %d signals, %d values\n", workloadName(), signals, shape.Count)
+	fmt.Fprintln(w, "\tMean\tStdDev\tMin\tMax\tSkew\tKurt")
+	fmt.Fprintf(w, "\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+		shape.Mean, shape.StdDev, shape.Min, shape.Max, shape.Skewness, shape.Kurtosis)
+	w.Flush()
+}
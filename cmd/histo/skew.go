@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var skew = flag.Bool("skew", false,
+	"Record signed clock skew deltas with exact zeros and report correctness of every backend")
+var skewSpread = flag.Float64("skew-spread", 10.0, "Maximum offset between clocks")
+
+// runSkew records signed workload into every histogram and reports whether
+// backend accepts it, quantile errors, and how often sign or zero of
+// quantiles differs from precise ones.
+func runSkew(histograms HistogramList) {
+	rnd := rand.New(rand.NewSource(*randSeed))
+	length := (*datapointsCount) * (*iterationsCount)
+	datasets := hdrbench.NewSkewDatasets(rnd, length, *minSignals, *skewSpread)
+
+	reference := histograms[0]
+	reference.Reset()
+	if err := reference.RecordValues(datasets, 0, length); err != nil {
+		glog.Fatal("Failed to record skew values: ", err)
+	}
+	expectedQ, err := reference.Quantiles(AllQuantiles)
+	if err != nil {
+		glog.Fatal("Failed to calculate expected quantiles: ", err)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprint(w, "Name\tNegative\tZero")
+	for i := range errorQuantiles {
+		fmt.Fprintf(w, "\t%v", errorQuantiles[i])
+	}
+	fmt.Fprintln(w, "\tSign\tZeros")
+	for _, hist := range histograms {
+		caps := hist.Capabilities()
+		fmt.Fprintf(w, "%s\t%v\t%v", hist.Name(), caps.Negative, caps.Zero)
+		hist.Reset()
+		if err := hist.RecordValues(datasets, 0, length); err != nil {
+			fmt.Fprintf(w, "\t%v\n", err)
+			continue
+		}
+		histQ, err := hist.Quantiles(AllQuantiles)
+		if err != nil {
+			glog.Fatal("Failed to calculate quantiles of ", hist.Name(), ": ", err)
+		}
+		errorQ := hdrbench.Quantiles(
+			hdrbench.QSortFloat(hdrbench.DiffRelative(expectedQ, histQ)), errorQuantiles)
+		for i := range errorQuantiles {
+			fmt.Fprintf(w, "\t%.2f%%", errorQ[i]*100)
+		}
+		signs, zeros := 0, 0
+		for i := range expectedQ {
+			if math.Signbit(expectedQ[i]) != math.Signbit(histQ[i]) && expectedQ[i] != histQ[i] {
+				signs++
+			}
+			if (expectedQ[i] == 0) != (histQ[i] == 0) {
+				zeros++
+			}
+		}
+		fmt.Fprintf(w, "\t%.2f%%\t%.2f%%\n",
+			float64(signs)*100/float64(len(expectedQ)), float64(zeros)*100/float64(len(expectedQ)))
+	}
+	w.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var stream = flag.Bool("stream", false,
+	"Generate signals window by window instead of materializing them in memory")
+var streamInput = flag.String("stream-input", "",
+	"Stream newline-delimited values of a single signal from file, '-' reads stdin")
+var spillLimit = flag.Int("spill-limit", 0,
+	"Number of values Precise histogram keeps in memory before spilling to disk, 0 never spills")
+var spillDir = flag.String("spill-dir", "", "Directory for spilled values, system temporary if empty")
+
+// streamWindows records next *datapointsCount values of every source,
+// a window is read once and recorded into every histogram, summary
+// accumulates values of read windows.
+func streamWindows(sources []hdrbench.DataSource, summary *hdrbench.Summary) windowRecorder {
+	current := -1
+	var window []*hdrbench.Dataset
+	return func(hist hdrbench.Histogram, iter int) error {
+		if iter != current {
+			var err error
+			if window, err = hdrbench.NextWindow(sources, *datapointsCount); err != nil {
+				return err
+			}
+			current = iter
+			for _, dataset := range window {
+				summary.Merge(dataset.Summary())
+			}
+		}
+		return hist.RecordValues(window, 0, *datapointsCount)
+	}
+}
+
+func runStream(histograms HistogramList, rnd *rand.Rand, singals int, heatmap *errorHeatmap) {
+	sources := hdrbench.NewLatencySources(
+		rnd, (*datapointsCount)*(*iterationsCount), singals, *outliers)
+	summary := new(hdrbench.Summary)
+	runIterations(histograms, nil, streamWindows(sources, summary), singals, *iterationsCount,
+		heatmap, nil, summary)
+}
+
+// runStreamInput reads -stream-input till the end.
+func runStreamInput(histograms HistogramList, heatmap *errorHeatmap) {
+	f := os.Stdin
+	if *streamInput != "-" {
+		var err error
+		if f, err = os.Open(*streamInput); err != nil {
+			glog.Fatal("Unable to open ", *streamInput, ": ", err)
+		}
+		defer f.Close()
+	}
+	source := hdrbench.NewReaderSource(*streamInput, f, *inputScale)
+	summary := new(hdrbench.Summary)
+	runIterations(histograms, nil, streamWindows([]hdrbench.DataSource{source}, summary), 1,
+		math.MaxInt32, heatmap, nil, summary)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var sweep = flag.Bool("sweep", false,
+	"Evaluate accuracy and memory of every backend configuration from the grid "+
+		"and report the Pareto frontier")
+var sweepSigfigs = flag.String("sweep-sigfigs", "1,2,3,4,5",
+	"Comma separated HDR significant figures to sweep")
+var sweepIntScales = flag.String("sweep-int-scale", "1,10,100,1000",
+	"Comma separated HDR int scales to sweep")
+var sweepCirconusDigits = flag.String("sweep-circonus-digits", "1,2,3",
+	"Comma separated Circonus significant digits to sweep")
+var sweepCirconusMaxBins = flag.String("sweep-circonus-max-bins", "0",
+	"Comma separated Circonus bin caps to sweep, 0 isn't capped")
+var sweepQuantile = flag.Float64("sweep-quantile", 0.99,
+	"Quantile which error is used to pick the Pareto frontier")
+var drawPareto = flag.Bool("draw-pareto", false,
+	"Draw memory against P99 and P99.9 errors of swept configurations (requires gnuplot)")
+var sweepMaxErr = flag.Float64("sweep-max-err", 0.01,
+	"Maximal relative error at -sweep-quantile of the cheapest configuration")
+
+// sweepQuantiles are quantiles reported by sweep, -sweep-quantile is added.
+var sweepQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// parseCounts parses comma separated non-negative integers.
+func parseCounts(spec string) []int {
+	counts := make([]int, 0)
+	for _, field := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 {
+			glog.Fatalf("Invalid count %q in %q", field, spec)
+		}
+		counts = append(counts, n)
+	}
+	return counts
+}
+
+func parseFloats(spec string) []float64 {
+	values := make([]float64, 0)
+	for _, field := range strings.Split(spec, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || v <= 0 {
+			glog.Fatalf("Invalid value %q in %q", field, spec)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// sweepConfigs is a grid of configurations of every backend.
+func sweepConfigs() []hdrbench.SweepConfig {
+	configs := hdrbench.HdrSweepConfigs(parseFanOut(*sweepSigfigs), parseFloats(*sweepIntScales))
+	return append(configs, hdrbench.CirconusSweepConfigs(
+		parseFanOut(*sweepCirconusDigits), parseCounts(*sweepCirconusMaxBins))...)
+}
+
+func runSweep() {
+	quantiles := sweepQuantiles
+	qi := -1
+	for i, q := range quantiles {
+		if q == *sweepQuantile {
+			qi = i
+		}
+	}
+	if qi < 0 {
+		quantiles = append(quantiles, *sweepQuantile)
+		qi = len(quantiles) - 1
+	}
+	configs := sweepConfigs()
+	method := parseQuantileMethod()
+	for singals := *minSignals; singals <= (*maxSignals); singals *= *signalMultiplier {
+		glog.Info("Sweeping ", len(configs), " configurations over ", singals, " signals")
+		rnd := rand.New(rand.NewSource(*randSeed))
+		datasets := hdrbench.NewLatencyDatasets(
+			rnd, (*datapointsCount)*(*iterationsCount), singals, *outliers)
+		points, err := hdrbench.Sweep(
+			configs, datasets, *datapointsCount, *iterationsCount, quantiles, method)
+		if err != nil {
+			glog.Fatal("Failed to sweep configurations: ", err)
+		}
+		reportSweep(singals, quantiles, qi, points)
+		if *drawPareto {
+			if err := plotPareto(singals, quantiles, points); err != nil {
+				glog.Error("Failed to draw Pareto frontier: ", err)
+			}
+		}
+	}
+}
+
+func reportSweep(signals int, quantiles []float64, qi int, points []hdrbench.SweepPoint) {
+	frontier := make(map[int]bool)
+	for _, i := range hdrbench.ParetoFrontier(points, qi) {
+		frontier[i] = true
+	}
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	fmt.Fprintln(w, signals, "signals, * marks Pareto frontier by P", quantiles[qi]*100, "error")
+	fmt.Fprint(w, "config\tmemory\tencoded")
+	for _, q := range quantiles {
+		fmt.Fprintf(w, "\tP%v", q*100)
+	}
+	fmt.Fprintln(w, "\t")
+	for i, point := range points {
+		fmt.Fprintf(w, "%s\t%d\t%d", point.Config, point.UsedMem, point.EncodedSize)
+		for _, e := range point.Errors {
+			fmt.Fprintf(w, "\t%.2f%%", e*100)
+		}
+		if frontier[i] {
+			fmt.Fprint(w, "\t*")
+		}
+		fmt.Fprintln(w, "\t")
+	}
+	w.Flush()
+	if cheapest := hdrbench.Cheapest(points, qi, *sweepMaxErr); cheapest >= 0 {
+		fmt.Printf("Cheapest under %.2f%% P%v error: %s, %d bytes\n",
+			*sweepMaxErr*100, quantiles[qi]*100, points[cheapest].Config, points[cheapest].UsedMem)
+	} else {
+		fmt.Printf("No configuration under %.2f%% P%v error\n", *sweepMaxErr*100, quantiles[qi]*100)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var topology = flag.String("topology", "",
+	"Comma separated fan-out of aggregation levels: signals per host, hosts per rack, "+
+		"racks per region. Regions are merged into global. Reports errors of global "+
+		"quantiles instead of flat merge")
+var topologySerialize = flag.Bool("topology-serialize", false,
+	"Serialize and deserialize histograms at every aggregation hop")
+
+func parseFanOut(spec string) []int {
+	fanOut := make([]int, 0)
+	for _, field := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			glog.Fatalf("Invalid fan-out %q in %q", field, spec)
+		}
+		fanOut = append(fanOut, n)
+	}
+	return fanOut
+}
+
+// runTopology aggregates every iteration through the aggregation tree and
+// compares global quantiles against the precise ones.
+func runTopology(histograms HistogramList, datasets []*hdrbench.Dataset,
+	singals int, iterations int) {
+
+	fanOut := parseFanOut(*topology)
+	glog.Info("Aggregating ", singals, " signals through ", *topology, " topology")
+	// iteration -> histogram -> quantile
+	flatErrors := make(quantileDiffHistory, iterations)
+	topologyErrors := make(quantileDiffHistory, iterations)
+	levels := make([][]hdrbench.TopologyLevel, len(histograms))
+	for iter := 0; iter < iterations; iter++ {
+		start, stop := iter*(*datapointsCount), (iter+1)*(*datapointsCount)
+		flatErrors[iter] = make([][]float64, len(histograms))
+		topologyErrors[iter] = make([][]float64, len(histograms))
+		reference := histograms[0]
+		reference.Reset()
+		if err := reference.RecordValues(datasets, start, stop); err != nil {
+			glog.Fatalf("Failed to record values iter %d hist %s", iter, reference.Name())
+		}
+		referenceQ, err := reference.Quantiles(AllQuantiles)
+		if err != nil {
+			glog.Fatalf("Failed to calculate quantiles at iter %d hist %s", iter, reference.Name())
+		}
+		for hi := 1; hi < len(histograms); hi++ {
+			hist := histograms[hi]
+			hist.Reset()
+			if err := hist.RecordValues(datasets, start, stop); err != nil {
+				glog.Fatalf("Failed to record values iter %d hist %s", iter, hist.Name())
+			}
+			flatQ, err := hist.Quantiles(AllQuantiles)
+			if err != nil {
+				glog.Fatalf("Failed to calculate quantiles at iter %d hist %s", iter, hist.Name())
+			}
+			global, histLevels, err := hdrbench.AggregateTopology(
+				hist, datasets, start, stop, fanOut, *topologySerialize)
+			if err != nil {
+				glog.Fatalf("Failed to aggregate iter %d hist %s: %v", iter, hist.Name(), err)
+			}
+			globalQ, err := global.Quantiles(AllQuantiles)
+			if err != nil {
+				glog.Fatalf("Failed to calculate quantiles at iter %d hist %s", iter, hist.Name())
+			}
+			flatErrors[iter][hi] = hdrbench.QSortFloat(hdrbench.DiffRelative(referenceQ, flatQ))
+			topologyErrors[iter][hi] = hdrbench.QSortFloat(hdrbench.DiffRelative(referenceQ, globalQ))
+			levels[hi] = histLevels
+		}
+	}
+	reportShape(singals, hdrbench.DatasetsShape(datasets))
+	reportTopologyErrors(histograms, flatErrors, topologyErrors, levels)
+}
+
+func reportTopologyErrors(histograms HistogramList, flatErrors, topologyErrors quantileDiffHistory,
+	levels [][]hdrbench.TopologyLevel) {
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 16, 8, 0, '\t', 0)
+	// start from 1 due of histograms[0] is alwasy Precise
+	for hIdx := 1; hIdx < len(histograms); hIdx++ {
+		fmt.Fprintln(w, histograms[hIdx].Name())
+		for i := range errorQuantiles {
+			fmt.Fprintf(w, "\t%v", errorQuantiles[i])
+		}
+		fmt.Fprintln(w)
+		for _, row := range []struct {
+			name   string
+			errors quantileDiffHistory
+		}{{"flat", flatErrors}, {"topology", topologyErrors}} {
+			// errors of all iterations are reported together
+			all := make([]float64, 0)
+			for iter := range row.errors {
+				all = append(all, row.errors[iter][hIdx]...)
+			}
+			errorQ := hdrbench.Quantiles(hdrbench.QSortFloat(all), errorQuantiles)
+			fmt.Fprint(w, row.name)
+			for i := range errorQuantiles {
+				fmt.Fprintf(w, "\t%.2f%%", errorQ[i]*100)
+			}
+			fmt.Fprintln(w)
+		}
+		for _, level := range levels[hIdx] {
+			fmt.Fprintf(w, "  %s\t%d nodes", level.Name, level.Nodes)
+			if *topologySerialize {
+				fmt.Fprintf(w, "\t%d bytes", level.Bytes)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	w.Flush()
+}
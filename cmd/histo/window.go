@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var arrivals = flag.String("arrivals", "",
+	"Generate signals with timestamps and measure errors over time windows: "+
+		"regular:interval=1, poisson:rate=1 or bursty:rate=1,burst-rate=20,burst=5,idle=60")
+var windowWidth = flag.Float64("window", 60, "Width of time windows in seconds")
+var windowStep = flag.Float64("window-step", 0,
+	"Step of sliding time windows in seconds, fixed windows if 0")
+
+// windowRecorder records iter-th window of values into hist.
+type windowRecorder func(hist hdrbench.Histogram, iter int) error
+
+// indexWindows records every *datapointsCount values of datasets.
+func indexWindows(datasets []*hdrbench.Dataset) windowRecorder {
+	return func(hist hdrbench.Histogram, iter int) error {
+		return hist.RecordValues(datasets, iter*(*datapointsCount), (iter+1)*(*datapointsCount))
+	}
+}
+
+// timeWindows records values of datasets arrived within windows.
+func timeWindows(datasets []*hdrbench.Dataset, windows []hdrbench.TimeWindow) windowRecorder {
+	return func(hist hdrbench.Histogram, iter int) error {
+		return hdrbench.RecordTimeWindow(hist, datasets, windows[iter])
+	}
+}
+
+// runTimeWindows generates signals arriving by -arrivals process and reports
+// errors over -window time windows.
+func runTimeWindows(histograms HistogramList, rnd *rand.Rand, singals int, heatmap *errorHeatmap) {
+	newProcess, err := hdrbench.ParseArrivals(*arrivals)
+	if err != nil {
+		glog.Fatal("Invalid -arrivals: ", err)
+	}
+	if *windowWidth <= 0 || *windowStep < 0 {
+		glog.Fatalf("Invalid -window %v or -window-step %v, width must be positive and step not negative",
+			*windowWidth, *windowStep)
+	}
+	step := *windowStep
+	if step == 0 {
+		step = *windowWidth
+	}
+	datasets := hdrbench.NewTimedLatencyDatasets(
+		rnd, (*datapointsCount)*(*iterationsCount), singals, *outliers, newProcess)
+	windows, err := hdrbench.TimeWindows(datasets, *windowWidth, step)
+	if err != nil {
+		glog.Fatal("Invalid time windows: ", err)
+	}
+	if len(windows) == 0 {
+		glog.Fatal("Signals are shorter than a window, increase -datapoints or decrease -window")
+	}
+	glog.Info(len(windows), " windows of ", *windowWidth, "s every ", step, "s")
+	runIterations(histograms, datasets, timeWindows(datasets, windows), singals, len(windows),
+		heatmap, nil, nil)
+}
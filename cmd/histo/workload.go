@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/golang/glog"
+	"github.com/octo47/hdrbench"
+)
+
+var workload = flag.String("workload", "",
+	"Workloads applied to generated signals joined with '+': "+
+		"step:at=600,factor=2, burst:period=240,length=20,jitter=0,factor=5, "+
+		"gc:prob=0.001,min=100,max=1000,interval=10, ramp:start=0,stop=1200,factor=3. "+
+		"Iterations with change points are marked with '*'")
+
+// applyWorkload applies -workload to datasets with random seeded by seed
+// and returns which of iterations contain change points.
+func applyWorkload(datasets []*hdrbench.Dataset, iterations int, seed int64) ([]*hdrbench.Dataset, []bool) {
+	changed := make([]bool, iterations)
+	if *workload == "" {
+		return datasets, changed
+	}
+	workloads, err := hdrbench.ParseWorkloads(*workload)
+	if err != nil {
+		glog.Fatal("Invalid -workload: ", err)
+	}
+	datasets, changes := hdrbench.ApplyWorkloads(datasets, workloads, seed)
+	for _, change := range changes {
+		if iter := change / *datapointsCount; iter < iterations {
+			changed[iter] = true
+		}
+	}
+	return datasets, changed
+}
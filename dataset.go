@@ -1,49 +1,39 @@
 package hdrbench
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"strconv"
 
-	"github.com/octo47/hdrbench/gnuplot"
 	"github.com/octo47/tsgen/generator"
 )
 
 type Dataset struct {
-	name                   string
-	dataset                []float64
-	min, max               float64
-	mean                   float64
+	name    string
+	dataset []float64
+	// optional arrival time of every value in seconds, non-decreasing
+	timestamps []float64
+	// optional weight of every value
+	weights                []float64
+	summary                Summary
 	upperBound, lowerBound float64
 }
 
 func NewDataset(name string, dataset []float64, upper, lower float64) *Dataset {
-	sum := 0.0
-	min := math.Inf(1)
-	max := math.Inf(-1)
-	for _, v := range dataset {
-		sum += v
-		if min > v {
-			min = v
-		}
-		if max < v {
-			max = v
-		}
+	summary := NewSummary(dataset)
+	if lower > summary.Min() {
+		lower = summary.Min()
 	}
-	if lower > min {
-		lower = min
+	if upper < summary.Max() {
+		upper = summary.Max()
 	}
-	if upper < max {
-		upper = max
-	}
-	mean := sum / float64(len(dataset))
 	dset := make([]float64, len(dataset))
 	copy(dset, dataset)
 	return &Dataset{
 		name:       name,
-		min:        min,
-		max:        max,
-		mean:       mean,
+		summary:    summary,
 		dataset:    dset,
 		upperBound: upper,
 		lowerBound: lower,
@@ -88,8 +78,59 @@ func NewLatencyDatasets(rnd *rand.Rand, n int, datasets int, outliers int) []*Da
 	return ds
 }
 
+// NewSkewDataset generates deltas between two clocks: offset wanders around
+// zero and is corrected back to it by sync every now and then, deltas are
+// quantized to resolution, so both signs and exact zeros are present.
+func NewSkewDataset(name string, seed int64, spread, resolution float64, n int) *Dataset {
+	rnd := rand.New(rand.NewSource(seed))
+	values := make([]float64, n)
+	offset := 0.0
+	for i := range values {
+		offset += rnd.NormFloat64() * spread / 100
+		if math.Abs(offset) > spread || rnd.Float64() < 0.001 {
+			// clock sync
+			offset = 0.0
+		}
+		delta := offset + rnd.NormFloat64()*spread/10
+		values[i] = float64(Round(delta/resolution)) * resolution
+	}
+	return NewDataset(name, values, spread, -spread)
+}
+
+// NewSkewDatasets generates datasets of clock skew deltas in [-spread, spread]
+// with resolution of spread/1000.
+func NewSkewDatasets(rnd *rand.Rand, n int, datasets int, spread float64) []*Dataset {
+	ds := make([]*Dataset, datasets)
+	for idx := range ds {
+		ds[idx] = NewSkewDataset("skew"+strconv.Itoa(idx), rnd.Int63(), spread, spread/1000, n)
+	}
+	return ds
+}
+
 func (fd *Dataset) UsedMem() int64 {
-	return int64(len(fd.dataset) * 8)
+	return int64((len(fd.dataset) + len(fd.timestamps) + len(fd.weights)) * 8)
+}
+
+// span clamps [start, stop) range to the length of dataset.
+func (fd *Dataset) span(start, stop int) (int, int) {
+	if stop > len(fd.dataset) {
+		stop = len(fd.dataset)
+	}
+	if start > stop {
+		start = stop
+	}
+	return start, stop
+}
+
+// values returns values in [start, stop) range, stop is clamped to
+// the length of dataset.
+func (fd *Dataset) values(start, stop int) []float64 {
+	start, stop = fd.span(start, stop)
+	return fd.dataset[start:stop]
+}
+
+func (fd *Dataset) Len() int {
+	return len(fd.dataset)
 }
 
 func (fd *Dataset) IntValue(idx int, scaleToInt float64) int64 {
@@ -97,15 +138,20 @@ func (fd *Dataset) IntValue(idx int, scaleToInt float64) int64 {
 }
 
 func (e *Dataset) Mean() float64 {
-	return e.mean
+	return e.summary.Mean()
 }
 
 func (e *Dataset) Min() float64 {
-	return e.min
+	return e.summary.Min()
 }
 
 func (e *Dataset) Max() float64 {
-	return e.max
+	return e.summary.Max()
+}
+
+// Summary returns exact statistics of values.
+func (e *Dataset) Summary() Summary {
+	return e.summary
 }
 
 func (e *Dataset) UpperBound() float64 {
@@ -117,38 +163,49 @@ func (e *Dataset) LowerBound() float64 {
 }
 
 func (e *Dataset) MeanInt(scaleToInt float64) int64 {
-	return int64(Round(float64(e.mean) * scaleToInt))
+	return int64(Round(e.Mean() * scaleToInt))
 }
 
 func (e *Dataset) MinInt(scaleToInt float64) int64 {
-	return int64(Round(float64(e.min) * scaleToInt))
+	return int64(Round(e.Min() * scaleToInt))
 }
 
 func (e *Dataset) MaxInt(scaleToInt float64) int64 {
-	return int64(Round(float64(e.max) * scaleToInt))
+	return int64(Round(e.Max() * scaleToInt))
 }
 
-func (e *Dataset) Sort() {
+// Sort sorts values in ascending order keeping their weights, timed
+// datasets can't be sorted as timestamps must stay in order.
+func (e *Dataset) Sort() error {
+	if e.timestamps != nil {
+		return fmt.Errorf("%s: timed dataset can't be sorted", e.name)
+	}
+	if e.weights != nil {
+		sort.Sort(weightedValues{e.dataset, e.weights})
+		return nil
+	}
 	e.dataset = QSortFloat(e.dataset)
+	return nil
 }
 
-func PlotDatasets(ds []*Dataset, fname string, batchSize int) error {
+// PlotDatasets draws median, min and max of every batchSize points of datasets.
+// With script set gnuplot script and data are written instead of an image.
+func PlotDatasets(ds []*Dataset, fname string, batchSize int, script bool) error {
 
-	p, err := gnuplot.NewPlotter("", false, false)
+	p, output, err := NewPlotter(fname, script)
 	if err != nil {
 		return err
 	}
 	defer p.Close()
 
 	p.SetStyle("lines")
-	p.CheckedCmd("set terminal png enhanced size 1280,1024")
+	p.CheckedCmd("set terminal unknown")
 
 	for dsI := range ds {
 		data := Downsample(ds[dsI].dataset, batchSize, []float64{0.5, 0.0, 1.0})
 		p.PlotXErrorBars(data, ds[dsI].name+strconv.Itoa(dsI))
 	}
-	p.CheckedCmd("set output '" + fname + "'")
-	p.CheckedCmd("replot")
+	RenderPlot(p, "png enhanced size 1280,1024", output)
 
 	p.CheckedCmd("q")
 	return nil
@@ -51,10 +51,23 @@ func helpDatasetQTest(t *testing.T, vals, qin, qexpect []float64) {
 		fuzzyEquals(t, qexpect[i], q)
 	}
 }
+func TestDatasetSort(t *testing.T) {
+	weighted, err := NewWeightedDataset("weighted", []float64{3, 1, 2}, []float64{30, 10, 20}, 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, weighted.Sort())
+	assert.Equal(t, []float64{10, 20, 30}, weighted.dataset)
+	assert.Equal(t, []float64{1, 2, 3}, weighted.Weights())
+
+	timed, err := NewTimedDataset("timed", []float64{1, 2, 3}, []float64{30, 10, 20}, 0, 0)
+	assert.NoError(t, err)
+	assert.Error(t, timed.Sort())
+	assert.Equal(t, []float64{30, 10, 20}, timed.dataset)
+}
+
 func TestDatasetQuantiles(t *testing.T) {
 	helpDatasetQTest(t, []float64{1}, []float64{0, 0.25, 0.5, 1}, []float64{1, 1, 1, 1})
 	helpDatasetQTest(t, s1,
 		[]float64{0, 0.25, 0.50, 0.95, 0.99, 1.0},
-		[]float64{0.01, 0.125, 0.3201, 0.43, 0.43, 0.43})
-	helpDatasetQTest(t, []float64{1.0, 2.0}, []float64{0.5}, []float64{2.0})
+		[]float64{0.01, 0.125, 0.2201, 0.43, 0.43, 0.43})
+	helpDatasetQTest(t, []float64{1.0, 2.0}, []float64{0.5}, []float64{1.0})
 }
@@ -1,18 +1,36 @@
 package hdrbench
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 
 	"github.com/go-errors/errors"
+	"github.com/golang/glog"
 	"github.com/octo47/hdrbench/circonusllhist"
 
 	"github.com/codahale/hdrhistogram"
 )
 
+// Capabilities describe values a backend records faithfully.
+type Capabilities struct {
+	// Values below zero are recorded, otherwise recording them fails
+	Negative bool
+	// Zero is kept apart from small values, so quantiles of
+	// zeros are exactly zero
+	Zero bool
+}
+
+// Histogram records values of datasets and estimates their quantiles.
+// Backends not capable of recording negative values return error
+// instead of recording them, see Capabilities.
 type Histogram interface {
 	Name() string
+	Capabilities() Capabilities
 	// Calculate quantiles
 	Quantiles(qin []float64) ([]float64, error)
 	ValueAtQuantile(qin float64) int64
@@ -20,10 +38,64 @@ type Histogram interface {
 	UsedMem() int64
 	Reset()
 	RecordValues(datasets []*Dataset, start, stop int) error
+	// Record values correcting for coordinated omission, expectedInterval
+	// is interval between values of a single dataset, 0 disables correction.
+	RecordCorrectedValues(datasets []*Dataset, start, stop int, expectedInterval float64) error
+	// Recorded values, every bucket is represented by a single value
+	Buckets() []Bucket
+	// Empty histogram of the same kind and configuration
+	Empty() Histogram
+	// Merge histogram of the same kind into this one
+	Merge(other Histogram) error
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// QuantileEstimator is implemented by histograms with selectable
+// definition of quantiles.
+type QuantileEstimator interface {
+	SetQuantileMethod(method QuantileMethod) error
+}
+
+// SetQuantileMethod makes hist estimate quantiles by method, it fails for
+// histograms supporting only their native definition.
+func SetQuantileMethod(hist Histogram, method QuantileMethod) error {
+	estimator, ok := hist.(QuantileEstimator)
+	if !ok {
+		if method == NativeQuantiles {
+			return nil
+		}
+		return errors.New(fmt.Sprintf("%s histogram doesn't support %v quantiles",
+			hist.Name(), method))
+	}
+	return estimator.SetQuantileMethod(method)
+}
+
+func mergeMismatch(hist, other Histogram) error {
+	return errors.New(fmt.Sprintf("Unable to merge %s histogram into %s",
+		other.Name(), hist.Name()))
+}
+
+// RecordCorrected calls record for v and for values missed due to a stall
+// of the recording process, same way HdrHistogram RecordCorrectedValue does.
+func RecordCorrected(v, expectedInterval float64, record func(float64) error) error {
+	if err := record(v); err != nil {
+		return err
+	}
+	if expectedInterval <= 0 || v <= expectedInterval {
+		return nil
+	}
+	for missingValue := v - expectedInterval; missingValue >= expectedInterval; missingValue -= expectedInterval {
+		if err := record(missingValue); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type circonusHistogram struct {
 	merged *circonusllhist.Histogram
+	method QuantileMethod
 }
 
 func NewCircosusHist() (Histogram, error) {
@@ -32,13 +104,68 @@ func NewCircosusHist() (Histogram, error) {
 	}, nil
 }
 
+// NewCirconusHist creates Circonus histogram of digits significant digits
+// (1 to 3) keeping up to maxBins bins, 0 means bins aren't capped.
+func NewCirconusHist(digits int, maxBins int) (Histogram, error) {
+	merged, err := circonusllhist.NewWithConfig(circonusllhist.Config{Digits: digits, MaxBins: maxBins})
+	if err != nil {
+		return nil, err
+	}
+	return &circonusHistogram{merged: merged}, nil
+}
+
+// newMerged makes empty histogram of the same configuration.
+func (hhist *circonusHistogram) newMerged() *circonusllhist.Histogram {
+	merged, _ := circonusllhist.NewWithConfig(hhist.merged.Config())
+	return merged
+}
+
 func (hhist *circonusHistogram) Reset() {
-	hhist.merged = circonusllhist.New()
+	hhist.merged = hhist.newMerged()
+}
+
+func (hhist *circonusHistogram) Empty() Histogram {
+	return &circonusHistogram{
+		merged: hhist.newMerged(),
+		method: hhist.method,
+	}
+}
+
+func (hhist *circonusHistogram) Merge(other Histogram) error {
+	o, ok := other.(*circonusHistogram)
+	if !ok {
+		return mergeMismatch(hhist, other)
+	}
+	return hhist.merged.Merge(o.merged)
+}
+
+func (hhist *circonusHistogram) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := hhist.merged.Serialize(buf)
+	return buf.Bytes(), err
+}
+
+func (hhist *circonusHistogram) UnmarshalBinary(data []byte) error {
+	merged, err := circonusllhist.Deserialize(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	hhist.merged = merged
+	return nil
 }
 
 func (hhist *circonusHistogram) RecordValues(
 	datasets []*Dataset,
 	start, stop int) error {
+	return hhist.RecordCorrectedValues(datasets, start, stop, 0)
+}
+
+// circonusllhist.RecordCorrectedValue works with integers only,
+// so float version of the same algorithm is used. Weighted values
+// are recorded as many times as weights add up to.
+func (hhist *circonusHistogram) RecordCorrectedValues(
+	datasets []*Dataset,
+	start, stop int, expectedInterval float64) error {
 
 	results := make([]*circonusllhist.Histogram, len(datasets))
 	errors := make([]error, len(datasets))
@@ -47,9 +174,18 @@ func (hhist *circonusHistogram) RecordValues(
 		wg.Add(1)
 		go func(idx int, dataset *Dataset) {
 			defer wg.Done()
-			hist := circonusllhist.New()
-			for _, v := range dataset.dataset[start:stop] {
-				err := hist.RecordValue(v)
+			hist := hhist.newMerged()
+			first, _ := dataset.span(start, stop)
+			counter := weightCounter{}
+			record := hist.RecordValue
+			for i, v := range dataset.values(start, stop) {
+				if dataset.weights != nil {
+					n := counter.count(dataset.weights[first+i])
+					record = func(v float64) error {
+						return hist.RecordValues(v, n)
+					}
+				}
+				err := RecordCorrected(v, expectedInterval, record)
 				if err != nil {
 					errors[idx] = err
 					return
@@ -63,7 +199,9 @@ func (hhist *circonusHistogram) RecordValues(
 		if errors[i] != nil {
 			return errors[i]
 		}
-		hhist.merged.Merge(results[i])
+		if err := hhist.merged.Merge(results[i]); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -77,10 +215,41 @@ func (hhist *circonusHistogram) Name() string {
 	return "Circonus"
 }
 
+// Capabilities of Circonus, sign is a part of bin and zero has its own bin.
+func (hhist *circonusHistogram) Capabilities() Capabilities {
+	return Capabilities{Negative: true, Zero: true}
+}
+
+// SetQuantileMethod selects interpolation within bins, Circonus
+// supports types 1 and 7 besides its native one.
+func (hhist *circonusHistogram) SetQuantileMethod(method QuantileMethod) error {
+	switch method {
+	case NativeQuantiles, InvertedCDF, Linear:
+		hhist.method = method
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Circonus histogram doesn't support %v quantiles", method))
+}
+
 func (hhist *circonusHistogram) Quantiles(qin []float64) ([]float64, error) {
+	switch hhist.method {
+	case InvertedCDF:
+		return hhist.merged.ApproxQuantile1(qin)
+	case Linear:
+		return hhist.merged.ApproxQuantile7(qin)
+	}
 	return hhist.merged.ApproxQuantile(qin)
 }
 
+func (hhist *circonusHistogram) Buckets() []Bucket {
+	bins := hhist.merged.Bins()
+	buckets := make([]Bucket, len(bins))
+	for i := range bins {
+		buckets[i] = Bucket{Value: bins[i].Midpoint(), Count: int64(bins[i].Count())}
+	}
+	return buckets
+}
+
 func (hhist *circonusHistogram) SignificantFigures() int64 {
 	return hhist.merged.SignificantFigures()
 }
@@ -106,15 +275,117 @@ func (hhist *hdrHistogram) Name() string {
 	return "HDR"
 }
 
+// Capabilities of HDR, it tracks values from 0, values scaled
+// to int below 0.5 are recorded as zero, so zero isn't kept apart.
+func (hhist *hdrHistogram) Capabilities() Capabilities {
+	return Capabilities{Negative: false, Zero: false}
+}
+
 func (hhist *hdrHistogram) Reset() {
 	hhist.merged = hdrhistogram.New(
 		0, 10^6, int(hhist.merged.SignificantFigures()))
 }
 
+// sameScale compares scales to int, a scale restored from encoded
+// ratio of HDR histogram may differ from the original in the last bits.
+func sameScale(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-12*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func (hhist *hdrHistogram) Empty() Histogram {
+	return &hdrHistogram{
+		merged: hdrhistogram.New(
+			hhist.merged.LowestTrackableValue(),
+			hhist.merged.HighestTrackableValue(),
+			int(hhist.merged.SignificantFigures())),
+		scaleToInt: hhist.scaleToInt,
+	}
+}
+
+func (hhist *hdrHistogram) Merge(other Histogram) error {
+	o, ok := other.(*hdrHistogram)
+	if !ok || !sameScale(o.scaleToInt, hhist.scaleToInt) {
+		return mergeMismatch(hhist, other)
+	}
+	if hhist.merged.HighestTrackableValue() < o.merged.HighestTrackableValue() {
+		newMerged := hdrhistogram.New(
+			hhist.merged.LowestTrackableValue(),
+			o.merged.HighestTrackableValue(),
+			int(hhist.merged.SignificantFigures()))
+		newMerged.Merge(hhist.merged)
+		hhist.merged = newMerged
+	}
+	dropped := hhist.merged.Merge(o.merged)
+	if dropped != 0 {
+		return errors.New(fmt.Sprintf("Dropped %d values during merge", dropped))
+	}
+	return nil
+}
+
+// MarshalBinary uses HdrHistogram V2 compressed encoding.
+func (hhist *hdrHistogram) MarshalBinary() ([]byte, error) {
+	highest := hhist.merged.HighestTrackableValue()
+	if highest < 2 {
+		highest = 2
+	}
+	hc, err := newHdrCounts(1, highest,
+		int32(hhist.merged.SignificantFigures()), 1/hhist.scaleToInt)
+	if err != nil {
+		return nil, err
+	}
+	for _, bar := range hhist.merged.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		if err := hc.record(bar.From, bar.Count); err != nil {
+			return nil, err
+		}
+	}
+	return hc.encode()
+}
+
+func (hhist *hdrHistogram) UnmarshalBinary(data []byte) error {
+	hc, err := decodeHdrCounts(data)
+	if err != nil {
+		return err
+	}
+	merged := hdrhistogram.New(0, hc.highest, int(hc.sigfigs))
+	for idx, count := range hc.counts {
+		if count == 0 {
+			continue
+		}
+		lowest, _ := hc.valueRange(idx)
+		if err := merged.RecordValues(lowest, count); err != nil {
+			return err
+		}
+	}
+	hhist.merged = merged
+	hhist.scaleToInt = 1 / hc.ratio
+	return nil
+}
+
 func (hhist *hdrHistogram) RecordValues(
 	datasets []*Dataset,
 	start, stop int) error {
+	return hhist.RecordCorrectedValues(datasets, start, stop, 0)
+}
 
+func (hhist *hdrHistogram) RecordCorrectedValues(
+	datasets []*Dataset,
+	start, stop int, expectedInterval float64) error {
+
+	for _, dataset := range datasets {
+		if dataset.Min() >= 0 {
+			continue
+		}
+		for _, v := range dataset.values(start, stop) {
+			if v < 0 {
+				return errors.New(fmt.Sprintf("HDR histogram can't record negative value %v of %s",
+					v, dataset.name))
+			}
+		}
+	}
+	interval := int64(Round(expectedInterval * hhist.scaleToInt))
 	max := int64(math.MinInt64)
 	for _, dataset := range datasets {
 		if max < dataset.MaxInt(hhist.scaleToInt) {
@@ -143,8 +414,15 @@ func (hhist *hdrHistogram) RecordValues(
 				hhist.merged.LowestTrackableValue(),
 				hhist.merged.HighestTrackableValue(),
 				int(hhist.merged.SignificantFigures()))
-			for idx := start; idx < stop; idx++ {
-				err := hist.RecordValue(dataset.IntValue(idx, hhist.scaleToInt))
+			counter := weightCounter{}
+			for i := start; i < stop && i < len(dataset.dataset); i++ {
+				var err error
+				if dataset.weights == nil {
+					err = hist.RecordCorrectedValue(dataset.IntValue(i, hhist.scaleToInt), interval)
+				} else {
+					err = recordCorrectedCount(hist, dataset.IntValue(i, hhist.scaleToInt), interval,
+						counter.count(dataset.weights[i]))
+				}
 				if err != nil {
 					errors[idx] = err
 					return
@@ -163,6 +441,26 @@ func (hhist *hdrHistogram) RecordValues(
 	return nil
 }
 
+// recordCorrectedCount is hdrhistogram RecordCorrectedValue recording
+// n values at once.
+func recordCorrectedCount(hist *hdrhistogram.Histogram, v, expectedInterval, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	if err := hist.RecordValues(v, n); err != nil {
+		return err
+	}
+	if expectedInterval <= 0 || v <= expectedInterval {
+		return nil
+	}
+	for missingValue := v - expectedInterval; missingValue >= expectedInterval; missingValue -= expectedInterval {
+		if err := hist.RecordValues(missingValue, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (hhist *hdrHistogram) Quantiles(qin []float64) ([]float64, error) {
 	qout := make([]float64, len(qin))
 	for i := range qin {
@@ -176,6 +474,20 @@ func (hhist *hdrHistogram) ValueAtQuantile(qin float64) int64 {
 	return v
 }
 
+func (hhist *hdrHistogram) Buckets() []Bucket {
+	buckets := make([]Bucket, 0)
+	for _, bar := range hhist.merged.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		buckets = append(buckets, Bucket{
+			Value: float64(bar.From+bar.To) / 2 / hhist.scaleToInt,
+			Count: bar.Count,
+		})
+	}
+	return buckets
+}
+
 func (hhist *hdrHistogram) SignificantFigures() int64 {
 	return hhist.merged.SignificantFigures()
 }
@@ -186,7 +498,14 @@ func (hhist *hdrHistogram) UsedMem() int64 {
 
 type preciseHistogram struct {
 	merged []float64
-	sorted bool
+	// weight of every value, nil while all of them weight 1
+	weights []float64
+	sorted  bool
+	method  QuantileMethod
+	// exact statistics of all recorded values
+	summary Summary
+	// nil unless values are spilled to disk
+	spill *spillRuns
 }
 
 func NewPreceiseHist() (Histogram, error) {
@@ -197,44 +516,272 @@ func NewPreceiseHist() (Histogram, error) {
 
 func (hhist *preciseHistogram) Reset() {
 	hhist.merged = make([]float64, 0)
+	hhist.weights = nil
+	hhist.summary = Summary{}
+	if hhist.spill != nil {
+		hhist.spill.remove()
+	}
+}
+
+// Close removes values spilled to disk.
+func (hhist *preciseHistogram) Close() error {
+	if hhist.spill == nil {
+		return nil
+	}
+	return hhist.spill.close()
+}
+
+func (hhist *preciseHistogram) Empty() Histogram {
+	empty := &preciseHistogram{
+		merged: make([]float64, 0),
+		method: hhist.method,
+	}
+	if hhist.spill != nil {
+		empty.spill = &spillRuns{dir: hhist.spill.dir, limit: hhist.spill.limit}
+	}
+	return empty
+}
+
+func (hhist *preciseHistogram) Merge(other Histogram) error {
+	o, ok := other.(*preciseHistogram)
+	if !ok {
+		return mergeMismatch(hhist, other)
+	}
+	if err := o.unspill(); err != nil {
+		return err
+	}
+	hhist.sorted = false
+	hhist.merged = append(hhist.merged, o.merged...)
+	hhist.addWeights(len(o.merged), o.weights)
+	hhist.summary.Merge(o.summary)
+	return hhist.spillIfFull()
+}
+
+// MarshalBinary writes all values as big endian float64,
+// weighted values aren't supported.
+func (hhist *preciseHistogram) MarshalBinary() ([]byte, error) {
+	if hhist.weights != nil {
+		return nil, errors.New("Precise histogram can't encode weighted values")
+	}
+	if err := hhist.unspill(); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.BigEndian, hhist.merged)
+	return buf.Bytes(), err
+}
+
+func (hhist *preciseHistogram) UnmarshalBinary(data []byte) error {
+	if len(data)%8 != 0 {
+		return errors.New("Precise histogram data is not a sequence of float64")
+	}
+	merged := make([]float64, len(data)/8)
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, merged); err != nil {
+		return err
+	}
+	if hhist.spill != nil {
+		hhist.spill.remove()
+	}
+	hhist.merged = merged
+	hhist.weights = nil
+	hhist.summary = NewSummary(merged)
+	hhist.sorted = false
+	return nil
 }
 
 func (hhist *preciseHistogram) Name() string {
 	return "Precise"
 }
 
+func (hhist *preciseHistogram) Capabilities() Capabilities {
+	return Capabilities{Negative: true, Zero: true}
+}
+
 func (hhist *preciseHistogram) RecordValues(
 	datasets []*Dataset,
 	start, stop int) error {
 
 	hhist.sorted = false
 	for _, dataset := range datasets {
-		hhist.merged = append(hhist.merged, dataset.dataset[start:stop]...)
+		first, stop := dataset.span(start, stop)
+		if dataset.weights == nil {
+			hhist.add(dataset.dataset[first:stop], nil)
+		} else {
+			hhist.add(dataset.dataset[first:stop], dataset.weights[first:stop])
+		}
+		if err := hhist.spillIfFull(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func (hhist *preciseHistogram) RecordCorrectedValues(
+	datasets []*Dataset,
+	start, stop int, expectedInterval float64) error {
+
+	hhist.sorted = false
+	for _, dataset := range datasets {
+		first, _ := dataset.span(start, stop)
+		value := make([]float64, 1)
+		for i, v := range dataset.values(start, stop) {
+			var weight []float64
+			if dataset.weights != nil {
+				weight = dataset.weights[first+i : first+i+1]
+			}
+			_ = RecordCorrected(v, expectedInterval, func(v float64) error {
+				value[0] = v
+				hhist.add(value, weight)
+				return nil
+			})
+		}
+		if err := hhist.spillIfFull(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add appends values of weights, nil weights mean every value weights 1.
+func (hhist *preciseHistogram) add(values, weights []float64) {
+	hhist.merged = append(hhist.merged, values...)
+	hhist.addWeights(len(values), weights)
+	for i, v := range values {
+		if weights == nil {
+			hhist.summary.Add(v)
+		} else {
+			hhist.summary.AddWeighted(v, weights[i])
+		}
+	}
+}
+
+// addWeights keeps weights in line with values after n values of weights
+// were added, nil weights mean every value weights 1. Weights are tracked
+// since the first weighted value.
+func (hhist *preciseHistogram) addWeights(n int, weights []float64) {
+	if weights == nil && hhist.weights == nil {
+		return
+	}
+	if hhist.weights == nil {
+		hhist.weights = make([]float64, len(hhist.merged)-n, cap(hhist.merged))
+		for i := range hhist.weights {
+			hhist.weights[i] = 1.0
+		}
+	}
+	if weights != nil {
+		hhist.weights = append(hhist.weights, weights...)
+		return
+	}
+	for i := 0; i < n; i++ {
+		hhist.weights = append(hhist.weights, 1.0)
+	}
+}
+
+func (hhist *preciseHistogram) sort() {
+	if hhist.sorted {
+		return
+	}
+	if hhist.weights == nil {
+		hhist.merged = sortValues(hhist.merged)
+	} else {
+		sort.Sort(weightedValues{values: hhist.merged, weights: hhist.weights})
+	}
+	hhist.sorted = true
+}
+
+// SetQuantileMethod selects definition of quantiles, weighted values
+// are always estimated by nearest rank.
+func (hhist *preciseHistogram) SetQuantileMethod(method QuantileMethod) error {
+	if method < NativeQuantiles || method > NormalUnbiased {
+		return errors.New(fmt.Sprintf("Unknown quantile method %v", method))
+	}
+	hhist.method = method
+	return nil
+}
+
+// selectLimit is number of quantiles up to which Precise histogram
+// selects them from unsorted values instead of sorting the values.
+const selectLimit = 16
+
 func (hhist *preciseHistogram) Quantiles(qin []float64) ([]float64, error) {
-	if !hhist.sorted {
-		hhist.merged = QSortFloat(hhist.merged)
-		hhist.sorted = true
+	spilled := hhist.spill != nil && len(hhist.spill.files) > 0
+	if len(hhist.merged) == 0 && !spilled {
+		return nil, errors.New("Precise histogram is empty")
+	}
+	if !hhist.sorted && hhist.weights == nil && !spilled && len(qin) <= selectLimit {
+		return SelectQuantiles(hhist.merged, qin, hhist.method), nil
 	}
-	return Quantiles(hhist.merged, qin), nil
+	hhist.sort()
+	if spilled {
+		return hhist.spill.quantiles(hhist.merged, qin, hhist.method)
+	}
+	if hhist.weights != nil {
+		return WeightedQuantiles(hhist.merged, hhist.weights, qin), nil
+	}
+	return EstimateQuantiles(hhist.merged, qin, hhist.method), nil
 }
 
 func (hhist *preciseHistogram) ValueAtQuantile(qin float64) int64 {
-	if !hhist.sorted {
-		hhist.merged = QSortFloat(hhist.merged)
-		hhist.sorted = true
+	if err := hhist.unspill(); err != nil {
+		glog.Fatal("Unable to load spilled values: ", err)
 	}
+	hhist.sort()
 	_, count := Quantile(hhist.merged, qin)
 	return count
 }
 
+func (hhist *preciseHistogram) Buckets() []Bucket {
+	if err := hhist.unspill(); err != nil {
+		glog.Fatal("Unable to load spilled values: ", err)
+	}
+	hhist.sort()
+	buckets := make([]Bucket, 0)
+	counter := weightCounter{}
+	for i, v := range hhist.merged {
+		count := int64(1)
+		if hhist.weights != nil {
+			count = counter.count(hhist.weights[i])
+		}
+		if len(buckets) > 0 && buckets[len(buckets)-1].Value == v {
+			buckets[len(buckets)-1].Count += count
+			continue
+		}
+		buckets = append(buckets, Bucket{Value: v, Count: count})
+	}
+	return buckets
+}
+
 func (hhist *preciseHistogram) SignificantFigures() int64 {
 	return 2
 }
 
+// ExactSummary returns exact statistics of values recorded into Precise
+// histogram, including spilled ones.
+func ExactSummary(hist Histogram) (Summary, error) {
+	precise, ok := hist.(*preciseHistogram)
+	if !ok {
+		return Summary{}, errors.New(fmt.Sprintf("%s histogram doesn't keep values", hist.Name()))
+	}
+	return precise.summary, nil
+}
+
+// SortedValues returns values recorded into Precise histogram
+// in ascending order. The slice is owned by the histogram.
+func SortedValues(hist Histogram) ([]float64, error) {
+	precise, ok := hist.(*preciseHistogram)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s histogram doesn't keep values", hist.Name()))
+	}
+	if precise.weights != nil {
+		return nil, errors.New("Precise histogram keeps weighted values")
+	}
+	if err := precise.unspill(); err != nil {
+		return nil, err
+	}
+	precise.sort()
+	return precise.merged, nil
+}
+
 func (hhist *preciseHistogram) UsedMem() int64 {
-	return int64(8 * len(hhist.merged))
+	return int64(8 * (len(hhist.merged) + len(hhist.weights)))
 }
@@ -14,11 +14,61 @@ func TestCirconusHist(t *testing.T) {
 	histTestHelper(t, hist)
 }
 
+func TestCirconusPrecision(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 2000, 10, 1)
+	quantiles := []float64{0.5, 0.9, 0.99}
+	phist, _ := NewPreceiseHist()
+	require.NoError(t, phist.RecordValues(datasets, 0, 2000))
+	expectedQ, _ := phist.Quantiles(quantiles)
+	for digits := 1; digits <= 3; digits++ {
+		hist, err := NewCirconusHist(digits, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(digits), hist.SignificantFigures())
+		require.NoError(t, hist.RecordValues(datasets, 0, 2000))
+		histQ, _ := hist.Quantiles(quantiles)
+		for _, diff := range DiffRelative(expectedQ, histQ) {
+			require.InDelta(t, 0.0, diff, math.Pow(10, float64(1-digits)), "digits %d", digits)
+		}
+		require.Equal(t, int64(digits), hist.Empty().SignificantFigures())
+	}
+	_, err := NewCirconusHist(4, 0)
+	require.Error(t, err)
+
+	capped, _ := NewCirconusHist(3, 200)
+	require.NoError(t, capped.RecordValues(datasets, 0, 2000))
+	require.Len(t, capped.Buckets(), 200)
+	histQ, _ := capped.Quantiles(quantiles[2:])
+	require.InDelta(t, 0.0, DiffRelative(expectedQ[2:], histQ)[0], 0.01)
+	data, err := capped.MarshalBinary()
+	require.NoError(t, err)
+	restored := capped.Empty()
+	require.NoError(t, restored.UnmarshalBinary(data))
+	require.Len(t, restored.Buckets(), 200)
+}
+
 func TestHdrHist(t *testing.T) {
 	hist, _ := NewHdrHist(0, 10^6, 2, 100.0)
 	histTestHelper(t, hist)
 }
 
+func TestHdrMergeDecoded(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 1000, 2, 0)
+	// 1/(1/0.9) isn't 0.9
+	hist, _ := NewHdrHist(0, 1000000, 2, 0.9)
+	require.NoError(t, hist.RecordValues(datasets, 0, 1000))
+	data, err := hist.MarshalBinary()
+	require.NoError(t, err)
+	decoded := hist.Empty()
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.NoError(t, hist.Merge(decoded))
+	require.NoError(t, decoded.Merge(hist))
+
+	other, _ := NewHdrHist(0, 1000000, 2, 10)
+	require.Error(t, hist.Merge(other))
+}
+
 func histTestHelper(t *testing.T, hist Histogram) {
 	rnd := rand.New(rand.NewSource(1234))
 	dset1 := NewLatencyDataset("ds1", rnd.Int63(), rnd.Int63(), 0, 1200.0, 1000)
@@ -57,3 +107,196 @@ func BenchmarkHdr(b *testing.B) {
 	b.StartTimer()
 	_ = hist.RecordValues([]*Dataset{dset}, 0, b.N)
 }
+
+func TestRecordCorrectedValues(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	observed, expected := NewStalledDatasets(rnd, 2000, 2, 10.0, 0.01, 500.0, 1000.0)
+	phist, _ := NewPreceiseHist()
+	require.NoError(t, phist.RecordValues(expected, 0, expected[0].Len()+expected[1].Len()))
+	expectedQ, _ := phist.Quantiles([]float64{0.5, 0.99})
+	for _, newHist := range []func() (Histogram, error){
+		NewPreceiseHist,
+		NewCircosusHist,
+		func() (Histogram, error) { return NewHdrHist(0, 1000000, 2, 100.0) },
+	} {
+		hist, _ := newHist()
+		require.NoError(t, hist.RecordValues(observed, 0, 2000))
+		uncorrectedQ, _ := hist.Quantiles([]float64{0.5, 0.99})
+		hist.Reset()
+		require.NoError(t, hist.RecordCorrectedValues(observed, 0, 2000, 10.0))
+		correctedQ, _ := hist.Quantiles([]float64{0.5, 0.99})
+		uncorrectedDiff := DiffRelative(expectedQ, uncorrectedQ)
+		correctedDiff := DiffRelative(expectedQ, correctedQ)
+		require.True(t, correctedDiff[1] < uncorrectedDiff[1], hist.Name())
+		require.InDelta(t, 0.0, correctedDiff[1], 0.05, hist.Name())
+	}
+}
+
+func TestSignedValues(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewSkewDatasets(rnd, 2000, 2, 10.0)
+	require.True(t, datasets[0].Min() < 0)
+	quantiles := []float64{0.01, 0.1, 0.5, 0.9, 0.99}
+	phist, _ := NewPreceiseHist()
+	require.NoError(t, phist.RecordValues(datasets, 0, 2000))
+	expectedQ, _ := phist.Quantiles(quantiles)
+	require.True(t, expectedQ[0] < 0)
+	require.True(t, expectedQ[4] > 0)
+	for _, newHist := range []func() (Histogram, error){
+		NewCircosusHist,
+		func() (Histogram, error) { return NewHdrHist(0, 1000000, 2, 100.0) },
+	} {
+		hist, _ := newHist()
+		err := hist.RecordValues(datasets, 0, 2000)
+		if !hist.Capabilities().Negative {
+			require.Error(t, err, hist.Name())
+			continue
+		}
+		require.NoError(t, err, hist.Name())
+		histQ, _ := hist.Quantiles(quantiles)
+		for i, diff := range DiffRelative(expectedQ, histQ) {
+			// two digit bins are within 10% of values close to zero
+			require.InDelta(t, 0.0, diff, 0.1, hist.Name())
+			require.Equal(t, expectedQ[i] < 0, histQ[i] < 0, hist.Name())
+		}
+	}
+}
+
+func TestZeroValues(t *testing.T) {
+	zeros := NewDataset("zeros", []float64{0, 0, 0, 0, 1, 2}, 2, 0)
+	// HDR scales values below 0.5/scaleToInt to zero
+	small := NewDataset("small", []float64{0, 0, 0.001, 0.001, 0.001}, 0.001, 0)
+	for _, newHist := range []func() (Histogram, error){
+		NewPreceiseHist,
+		NewCircosusHist,
+		func() (Histogram, error) { return NewHdrHist(0, 1000000, 2, 100.0) },
+	} {
+		hist, _ := newHist()
+		require.NoError(t, hist.RecordValues([]*Dataset{zeros}, 0, 6), hist.Name())
+		q, _ := hist.Quantiles([]float64{0.5})
+		require.Equal(t, 0.0, q[0], hist.Name())
+
+		hist, _ = newHist()
+		require.NoError(t, hist.RecordValues([]*Dataset{small}, 0, 5), hist.Name())
+		q, _ = hist.Quantiles([]float64{0.5})
+		if hist.Capabilities().Zero {
+			require.True(t, q[0] > 0, hist.Name())
+		} else {
+			require.Equal(t, 0.0, q[0], hist.Name())
+		}
+	}
+}
+
+func TestSetQuantileMethod(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 1000, 2, 0)
+	quantiles := []float64{0.1, 0.5, 0.99}
+	precise, _ := NewPreceiseHist()
+	require.NoError(t, precise.RecordValues(datasets, 0, 1000))
+	require.NoError(t, SetQuantileMethod(precise, Linear))
+	linearQ, _ := precise.Quantiles(quantiles)
+	sorted, _ := SortedValues(precise)
+	require.Equal(t, EstimateQuantiles(sorted, quantiles, Linear), linearQ)
+
+	circonus, _ := NewCircosusHist()
+	require.NoError(t, circonus.RecordValues(datasets, 0, 1000))
+	require.NoError(t, SetQuantileMethod(circonus, Linear))
+	circonusQ, _ := circonus.Quantiles(quantiles)
+	for _, diff := range DiffRelative(linearQ, circonusQ) {
+		require.InDelta(t, 0.0, diff, 0.05)
+	}
+	require.Error(t, SetQuantileMethod(circonus, Hazen))
+
+	hdr, _ := NewHdrHist(0, 1000000, 2, 100.0)
+	require.NoError(t, SetQuantileMethod(hdr, NativeQuantiles))
+	require.Error(t, SetQuantileMethod(hdr, Linear))
+}
+
+func TestExactSummary(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 1000, 2, 1)
+	hist, _ := NewPreceiseHist()
+	other := hist.Empty()
+	require.NoError(t, hist.RecordValues(datasets, 0, 500))
+	require.NoError(t, other.RecordValues(datasets, 500, 1000))
+	require.NoError(t, hist.Merge(other))
+	summary, err := ExactSummary(hist)
+	require.NoError(t, err)
+	sorted, _ := SortedValues(hist)
+	expected := NewSummary(sorted)
+	require.Equal(t, expected.Count(), summary.Count())
+	require.InEpsilon(t, expected.Mean(), summary.Mean(), 1e-12)
+	require.InEpsilon(t, expected.StdDev(), summary.StdDev(), 1e-9)
+	require.Equal(t, datasets[2].Max(), summary.Max())
+
+	hdr, _ := NewHdrHist(0, 1000000, 2, 100.0)
+	_, err = ExactSummary(hdr)
+	require.Error(t, err)
+}
+
+func TestAggregateTopology(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 500, 24, 1)
+	phist, _ := NewPreceiseHist()
+	require.NoError(t, phist.RecordValues(datasets, 0, 500))
+	quantiles := []float64{0.1, 0.5, 0.7, 0.95, 0.99}
+	phistQ, _ := phist.Quantiles(quantiles)
+	hdr, _ := NewHdrHist(0, 1000000, 2, 100.0)
+	circonus, _ := NewCircosusHist()
+	for _, proto := range []Histogram{phist.Empty(), hdr, circonus} {
+		for _, serialize := range []bool{false, true} {
+			global, levels, err := AggregateTopology(proto, datasets, 0, 500,
+				[]int{4, 2, 2}, serialize)
+			require.NoError(t, err)
+			require.Len(t, levels, 4)
+			require.Equal(t, []int{7, 4, 2, 1}, []int{
+				levels[0].Nodes, levels[1].Nodes, levels[2].Nodes, levels[3].Nodes})
+			if serialize {
+				require.True(t, levels[0].Bytes > 0)
+			}
+			histQ, _ := global.Quantiles(quantiles)
+			for _, diff := range DiffRelative(phistQ, histQ) {
+				require.InDelta(t, 0.0, diff, 0.05, global.Name())
+			}
+		}
+	}
+}
+
+func TestRollup(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 600, 3, 1)
+	phist, _ := NewPreceiseHist()
+	circonus, _ := NewCircosusHist()
+	quantiles := []float64{0.5, 0.99}
+	for _, proto := range []Histogram{phist, circonus} {
+		resolutions, err := Rollup(proto, datasets, 5, []int{10, 6, 5}, quantiles, NativeQuantiles)
+		require.NoError(t, err)
+		require.Len(t, resolutions, 4)
+		for i, windows := range []int{120, 12, 2, 0} {
+			require.Len(t, resolutions[i].Errors, windows)
+		}
+		require.Equal(t, 60, resolutions[2].Seconds)
+		// rolled up sketches converge to exact quantiles on larger windows
+		delta := 0.05
+		if proto == phist {
+			delta = 0.0
+		}
+		for _, errors := range resolutions[2].Errors {
+			for _, diff := range errors {
+				require.InDelta(t, 0.0, diff, delta, proto.Name())
+			}
+		}
+	}
+	// exact quantiles follow the method of rolled up ones
+	linear, _ := NewPreceiseHist()
+	require.NoError(t, SetQuantileMethod(linear, Linear))
+	resolutions, err := Rollup(linear, datasets, 5, []int{10}, quantiles, Linear)
+	require.NoError(t, err)
+	for _, resolution := range resolutions {
+		for _, errors := range resolution.Errors {
+			require.Equal(t, []float64{0, 0}, errors)
+		}
+	}
+	_, err = Rollup(phist, datasets, 0, []int{10}, quantiles, NativeQuantiles)
+	require.Error(t, err)
+}
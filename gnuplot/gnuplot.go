@@ -12,9 +12,12 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 var g_gnuplot_cmd string
+var g_gnuplot_lookup_err error
 var g_gnuplot_prefix string = "go-gnuplot-"
 
 func min(a, b int) int {
@@ -25,12 +28,8 @@ func min(a, b int) int {
 }
 
 func init() {
-	var err error
-	g_gnuplot_cmd, err = exec.LookPath("gnuplot")
-	if err != nil {
-		fmt.Printf("** could not find path to 'gnuplot':\n%v\n", err)
-		panic("could not find 'gnuplot'")
-	}
+	// gnuplot is only required for live plotting, script mode works without it
+	g_gnuplot_cmd, g_gnuplot_lookup_err = exec.LookPath("gnuplot")
 }
 
 type gnuplot_error struct {
@@ -47,6 +46,10 @@ type plotter_process struct {
 }
 
 func new_plotter_proc(persist bool) (*plotter_process, error) {
+	if g_gnuplot_lookup_err != nil {
+		return nil, &gnuplot_error{
+			fmt.Sprintf("could not find path to 'gnuplot': %v", g_gnuplot_lookup_err)}
+	}
 	proc_args := []string{}
 	if persist {
 		proc_args = append(proc_args, "-persist")
@@ -62,10 +65,34 @@ func new_plotter_proc(persist bool) (*plotter_process, error) {
 
 type tmpfiles_db map[string]*os.File
 
+// plotter_script collects commands into a gnuplot script file and keeps
+// data files next to it, so the plot can be rendered later with
+//   cd <dir> && gnuplot <script>
+type plotter_script struct {
+	handle *os.File
+	dir    string // directory of the script, data files are put there too
+	prefix string // data files are named <prefix>-<n>.dat
+	ndata  int    // number of data files written so far
+}
+
+func new_plotter_script(fname string) (*plotter_script, error) {
+	f, err := os.Create(fname)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(fname)
+	return &plotter_script{
+		handle: f,
+		dir:    filepath.Dir(fname),
+		prefix: strings.TrimSuffix(base, filepath.Ext(base)),
+	}, nil
+}
+
 // Plotter is a handle to a gnuplot subprocess, forwarding commands
-// via its stdin
+// via its stdin, or to a gnuplot script file if created with a file name.
 type Plotter struct {
 	proc     *plotter_process
+	script   *plotter_script
 	debug    bool
 	plotcmd  string
 	nplots   int    // number of currently active plots
@@ -73,8 +100,31 @@ type Plotter struct {
 	tmpfiles tmpfiles_db
 }
 
-// Cmd sends a command to the gnuplot subprocess and returns an error
-// if something bad happened in the gnuplot process.
+// datafile creates a file for the next data set to plot. It returns the
+// opened file and the name gnuplot should refer to it by.
+// Data files of a live subprocess are temporary and removed by ResetPlot,
+// data files of a script are kept, they are referenced relative to the
+// script directory.
+func (self *Plotter) datafile() (*os.File, string, error) {
+	if self.script != nil {
+		name := fmt.Sprintf("%s-%d.dat", self.script.prefix, self.script.ndata)
+		f, err := os.Create(filepath.Join(self.script.dir, name))
+		if err != nil {
+			return nil, "", err
+		}
+		self.script.ndata += 1
+		return f, name, nil
+	}
+	f, err := ioutil.TempFile(os.TempDir(), g_gnuplot_prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	self.tmpfiles[f.Name()] = f
+	return f, f.Name(), nil
+}
+
+// Cmd sends a command to the gnuplot subprocess (or appends it to the script)
+// and returns an error if something bad happened in the gnuplot process.
 // ex:
 //   fname := "foo.dat"
 //   err := p.Cmd("plot %s", fname)
@@ -83,7 +133,13 @@ type Plotter struct {
 //   }
 func (self *Plotter) Cmd(format string, a ...interface{}) error {
 	cmd := fmt.Sprintf(format, a...) + "\n"
-	n, err := io.WriteString(self.proc.stdin, cmd)
+	var out io.Writer
+	if self.script != nil {
+		out = self.script.handle
+	} else {
+		out = self.proc.stdin
+	}
+	n, err := io.WriteString(out, cmd)
 
 	if self.debug {
 		//buf := new(bytes.Buffer)
@@ -119,6 +175,9 @@ func (self *Plotter) Close() (err error) {
 		self.proc.stdin.Close()
 		err = self.proc.handle.Wait()
 	}
+	if self.script != nil {
+		err = self.script.handle.Close()
+	}
 	self.ResetPlot()
 	return err
 }
@@ -153,12 +212,10 @@ func (self *Plotter) PlotNd(title string, data ...[]float64) error {
 // Example:
 //  err = p.PlotX([]float64{10, 20, 30}, "my title")
 func (self *Plotter) PlotX(data []float64, title string) error {
-	f, err := ioutil.TempFile(os.TempDir(), g_gnuplot_prefix)
+	f, fname, err := self.datafile()
 	if err != nil {
 		return err
 	}
-	fname := f.Name()
-	self.tmpfiles[fname] = f
 	for _, d := range data {
 		f.WriteString(fmt.Sprintf("%v\n", d))
 	}
@@ -187,12 +244,10 @@ func (self *Plotter) PlotX(data []float64, title string) error {
 //  err = p.PlotX([]float64{10, 9, 11, 20, 19, 22, 30, 29, 33}, "my title")
 func (self *Plotter) PlotXErrorBars(
 	data []float64, title string) error {
-	f, err := ioutil.TempFile(os.TempDir(), g_gnuplot_prefix)
+	f, fname, err := self.datafile()
 	if err != nil {
 		return err
 	}
-	fname := f.Name()
-	self.tmpfiles[fname] = f
 	for i := 0; i < len(data); i += 3 {
 		f.WriteString(fmt.Sprintf("%d\t%v\t%v\t%v\n", i/3, data[i], data[i+1], data[i+2]))
 	}
@@ -227,12 +282,10 @@ func (self *Plotter) PlotXErrorBars(
 func (self *Plotter) PlotXY(x, y []float64, title string) error {
 	npoints := min(len(x), len(y))
 
-	f, err := ioutil.TempFile(os.TempDir(), g_gnuplot_prefix)
+	f, fname, err := self.datafile()
 	if err != nil {
 		return err
 	}
-	fname := f.Name()
-	self.tmpfiles[fname] = f
 
 	for i := 0; i < npoints; i++ {
 		f.WriteString(fmt.Sprintf("%v %v\n", x[i], y[i]))
@@ -268,12 +321,10 @@ func (self *Plotter) PlotXY(x, y []float64, title string) error {
 func (self *Plotter) PlotXYZ(x, y, z []float64, title string) error {
 	npoints := min(len(x), len(y))
 	npoints = min(npoints, len(z))
-	f, err := ioutil.TempFile(os.TempDir(), g_gnuplot_prefix)
+	f, fname, err := self.datafile()
 	if err != nil {
 		return err
 	}
-	fname := f.Name()
-	self.tmpfiles[fname] = f
 
 	for i := 0; i < npoints; i++ {
 		f.WriteString(fmt.Sprintf("%v %v %v\n", x[i], y[i], z[i]))
@@ -296,6 +347,47 @@ func (self *Plotter) PlotXYZ(x, y, z []float64, title string) error {
 	return self.Cmd(line)
 }
 
+// PlotMatrix will create a heatmap of the `data` matrix with `title` as the
+// plot title.
+// Column index of an element is used as the x-coordinate, row index as the
+// y-coordinate and the value itself as the colour of the cell.
+// Example:
+//  err = p.PlotMatrix(
+//           [][]float64{{1, 2, 3}, {4, 5, 6}},
+//           "my title")
+func (self *Plotter) PlotMatrix(data [][]float64, title string) error {
+	f, fname, err := self.datafile()
+	if err != nil {
+		return err
+	}
+
+	for _, row := range data {
+		for i, v := range row {
+			if i > 0 {
+				f.WriteString(" ")
+			}
+			f.WriteString(fmt.Sprintf("%v", v))
+		}
+		f.WriteString("\n")
+	}
+
+	f.Close()
+	cmd := self.plotcmd
+	if self.nplots > 0 {
+		cmd = "replot"
+	}
+
+	var line string
+	if title == "" {
+		line = fmt.Sprintf("%s \"%s\" matrix with image", cmd, fname)
+	} else {
+		line = fmt.Sprintf("%s \"%s\" matrix title \"%s\" with image",
+			cmd, fname, title)
+	}
+	self.nplots += 1
+	return self.Cmd(line)
+}
+
 // Func is a 1-d function which can be plotted with gnuplot
 type Func func(x float64) float64
 
@@ -309,12 +401,10 @@ type Func func(x float64) float64
 //           "my title")
 func (self *Plotter) PlotFunc(data []float64, fct Func, title string) error {
 
-	f, err := ioutil.TempFile(os.TempDir(), g_gnuplot_prefix)
+	f, fname, err := self.datafile()
 	if err != nil {
 		return err
 	}
-	fname := f.Name()
-	self.tmpfiles[fname] = f
 
 	for _, x := range data {
 		f.WriteString(fmt.Sprintf("%v %v\n", x, fct(x)))
@@ -439,24 +529,29 @@ func (self *Plotter) SetLabels(labels ...string) error {
 }
 
 // ResetPlot clears up all plots and sets the Plotter state anew.
+// Temporary data files are removed, data files of a script are kept.
 func (self *Plotter) ResetPlot() (err error) {
 	for fname, fhandle := range self.tmpfiles {
-		ferr := fhandle.Close()
-		if ferr != nil {
+		fhandle.Close()
+		ferr := os.Remove(fname)
+		if ferr != nil && !os.IsNotExist(ferr) {
 			err = ferr
 		}
-		os.Remove(fname)
 	}
+	self.tmpfiles = make(tmpfiles_db)
 	self.nplots = 0
 	return err
 }
 
 // NewPlotter creates a new Plotter instance.
-//  - `fname` is the name of the file containing commands (should be empty for now)
+//  - `fname` is the name of the gnuplot script to write commands to. Data
+//    files are written next to it and kept, so the script can be rendered
+//    later without a gnuplot installation at hand. If empty, commands are
+//    sent to a gnuplot subprocess.
 //  - `persist` is a flag to run the gnuplot subprocess with '-persist' so the
 //    plot window isn't closed after sending a command
 //  - `debug` is a flag to tell go-gnuplot to print out every command sent to
-//    the gnuplot subprocess.
+//    the gnuplot subprocess or script.
 // Example:
 //  p, err := gnuplot.NewPlotter("", false, false)
 //  if err != nil { /* handle error */ }
@@ -467,7 +562,11 @@ func NewPlotter(fname string, persist, debug bool) (*Plotter, error) {
 	p.tmpfiles = make(tmpfiles_db)
 
 	if fname != "" {
-		panic("NewPlotter with fname is not yet supported")
+		script, err := new_plotter_script(fname)
+		if err != nil {
+			return nil, err
+		}
+		p.script = script
 	} else {
 		proc, err := new_plotter_proc(persist)
 		if err != nil {
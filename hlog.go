@@ -0,0 +1,543 @@
+package hdrbench
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HdrHistogram interval log format (.hlog) support, see
+// https://github.com/HdrHistogram/HdrHistogram/blob/master/GoogleChartsExample/README.md
+// Histograms are stored in V2 compressed encoding, so logs are
+// interchangeable with Java HistogramLogReader/HistogramLogWriter.
+
+const (
+	hdrV2EncodingCookie           = 0x1c849303 | 0x10
+	hdrV2CompressedEncodingCookie = 0x1c849304 | 0x10
+	hdrCookieBaseMask             = ^0xf0
+	hdrV2HeaderSize               = 40
+	hlogFormatVersion             = "1.3"
+)
+
+// Bucket is a range of recorded values represented by a single value.
+type Bucket struct {
+	Value float64
+	Count int64
+}
+
+// hdrCounts is a histogram in HdrHistogram counts array layout.
+type hdrCounts struct {
+	lowest, highest int64
+	sigfigs         int32
+	// integerToDoubleValueConversionRatio, counts are recorded as
+	// integers, ratio converts them back to original values
+	ratio  float64
+	counts []int64
+
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int64
+	subBucketMask               int64
+}
+
+func newHdrCounts(lowest, highest int64, sigfigs int32, ratio float64) (*hdrCounts, error) {
+	if sigfigs < 1 || sigfigs > 5 {
+		return nil, fmt.Errorf("significant figures must be in [1,5], got %d", sigfigs)
+	}
+	if lowest < 1 || highest < 2*lowest {
+		return nil, fmt.Errorf("invalid trackable range [%d,%d]", lowest, highest)
+	}
+	hc := &hdrCounts{
+		lowest:  lowest,
+		highest: highest,
+		sigfigs: sigfigs,
+		ratio:   ratio,
+	}
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(int(sigfigs))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	if subBucketCountMagnitude < 1 {
+		subBucketCountMagnitude = 1
+	}
+	hc.subBucketHalfCountMagnitude = subBucketCountMagnitude - 1
+	hc.unitMagnitude = uint(math.Floor(math.Log2(float64(lowest))))
+	subBucketCount := int64(1) << (hc.subBucketHalfCountMagnitude + 1)
+	hc.subBucketHalfCount = subBucketCount / 2
+	hc.subBucketMask = (subBucketCount - 1) << hc.unitMagnitude
+
+	// number of buckets needed to cover highest
+	smallestUntrackableValue := subBucketCount << hc.unitMagnitude
+	bucketsNeeded := 1
+	for smallestUntrackableValue <= highest {
+		if smallestUntrackableValue > math.MaxInt64/2 {
+			bucketsNeeded++
+			break
+		}
+		smallestUntrackableValue <<= 1
+		bucketsNeeded++
+	}
+	hc.counts = make([]int64, (bucketsNeeded+1)*int(hc.subBucketHalfCount))
+	return hc, nil
+}
+
+func bitLen(v uint64) uint {
+	n := uint(0)
+	for ; v != 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+func (hc *hdrCounts) countsIndex(v int64) int {
+	pow2ceiling := bitLen(uint64(v | hc.subBucketMask))
+	bucketIdx := int64(pow2ceiling) - int64(hc.unitMagnitude) - int64(hc.subBucketHalfCountMagnitude+1)
+	subBucketIdx := v >> uint(bucketIdx+int64(hc.unitMagnitude))
+	return int(((bucketIdx + 1) << hc.subBucketHalfCountMagnitude) +
+		(subBucketIdx - hc.subBucketHalfCount))
+}
+
+// valueRange returns lowest equivalent value of counts index and
+// the size of its range.
+func (hc *hdrCounts) valueRange(idx int) (int64, int64) {
+	bucketIdx := int64(idx>>hc.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := int64(idx)&(hc.subBucketHalfCount-1) + hc.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= hc.subBucketHalfCount
+		bucketIdx = 0
+	}
+	shift := uint(bucketIdx) + hc.unitMagnitude
+	return subBucketIdx << shift, int64(1) << shift
+}
+
+func (hc *hdrCounts) record(v int64, n int64) error {
+	if v < 0 {
+		return fmt.Errorf("negative value %d can't be recorded", v)
+	}
+	idx := hc.countsIndex(v)
+	if idx < 0 || idx >= len(hc.counts) {
+		return fmt.Errorf("value %d is out of trackable range", v)
+	}
+	hc.counts[idx] += n
+	return nil
+}
+
+// buckets returns non empty ranges represented by their median values.
+func (hc *hdrCounts) buckets() []Bucket {
+	result := make([]Bucket, 0)
+	for idx, count := range hc.counts {
+		if count == 0 {
+			continue
+		}
+		lowest, size := hc.valueRange(idx)
+		result = append(result, Bucket{
+			Value: float64(lowest+size>>1) * hc.ratio,
+			Count: count,
+		})
+	}
+	return result
+}
+
+func putZigZag(buf *bytes.Buffer, v int64) {
+	u := uint64((v << 1) ^ (v >> 63))
+	for i := 0; i < 8; i++ {
+		if u < 0x80 {
+			buf.WriteByte(byte(u))
+			return
+		}
+		buf.WriteByte(byte(u&0x7f) | 0x80)
+		u >>= 7
+	}
+	// 9th byte holds all remaining 8 bits
+	buf.WriteByte(byte(u))
+}
+
+func getZigZag(r *bytes.Reader) (int64, error) {
+	u := uint64(0)
+	for i := uint(0); i < 9; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if i == 8 {
+			u |= uint64(b) << 56
+			break
+		}
+		u |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+// encode writes histogram in V2 compressed encoding.
+func (hc *hdrCounts) encode() ([]byte, error) {
+	payload := new(bytes.Buffer)
+	relevant := len(hc.counts)
+	for relevant > 0 && hc.counts[relevant-1] == 0 {
+		relevant--
+	}
+	for idx := 0; idx < relevant; {
+		count := hc.counts[idx]
+		idx++
+		if count == 0 {
+			zeros := int64(1)
+			for idx < relevant && hc.counts[idx] == 0 {
+				zeros++
+				idx++
+			}
+			if zeros > 1 {
+				putZigZag(payload, -zeros)
+				continue
+			}
+		}
+		putZigZag(payload, count)
+	}
+
+	encoded := new(bytes.Buffer)
+	header := []interface{}{
+		int32(hdrV2EncodingCookie),
+		int32(payload.Len()),
+		int32(0), // normalizingIndexOffset
+		hc.sigfigs,
+		hc.lowest,
+		hc.highest,
+		hc.ratio,
+	}
+	for _, field := range header {
+		if err := binary.Write(encoded, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	encoded.Write(payload.Bytes())
+
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	if _, err := zw.Write(encoded.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	result := new(bytes.Buffer)
+	_ = binary.Write(result, binary.BigEndian, int32(hdrV2CompressedEncodingCookie))
+	_ = binary.Write(result, binary.BigEndian, int32(compressed.Len()))
+	result.Write(compressed.Bytes())
+	return result.Bytes(), nil
+}
+
+// decodeHdrCounts reads histogram in V2 compressed encoding.
+func decodeHdrCounts(data []byte) (*hdrCounts, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated compressed histogram")
+	}
+	cookie := int32(binary.BigEndian.Uint32(data))
+	if cookie&hdrCookieBaseMask != hdrV2CompressedEncodingCookie&hdrCookieBaseMask {
+		return nil, fmt.Errorf("unsupported compressed histogram cookie %x", cookie)
+	}
+	length := int(binary.BigEndian.Uint32(data[4:]))
+	if length > len(data)-8 {
+		return nil, errors.New("truncated compressed histogram")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data[8 : 8+length]))
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if len(encoded) < hdrV2HeaderSize {
+		return nil, errors.New("truncated histogram")
+	}
+
+	var header struct {
+		Cookie                 int32
+		PayloadLength          int32
+		NormalizingIndexOffset int32
+		Sigfigs                int32
+		Lowest, Highest        int64
+		Ratio                  float64
+	}
+	if err := binary.Read(bytes.NewReader(encoded), binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Cookie&hdrCookieBaseMask != hdrV2EncodingCookie&hdrCookieBaseMask {
+		return nil, fmt.Errorf("unsupported histogram cookie %x", header.Cookie)
+	}
+	if header.NormalizingIndexOffset != 0 {
+		return nil, errors.New("normalized histograms are not supported")
+	}
+	if int(header.PayloadLength) > len(encoded)-hdrV2HeaderSize {
+		return nil, errors.New("truncated histogram payload")
+	}
+	hc, err := newHdrCounts(header.Lowest, header.Highest, header.Sigfigs, header.Ratio)
+	if err != nil {
+		return nil, err
+	}
+	payload := bytes.NewReader(encoded[hdrV2HeaderSize : hdrV2HeaderSize+int(header.PayloadLength)])
+	for idx := 0; payload.Len() > 0; {
+		count, err := getZigZag(payload)
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			idx += int(-count)
+			continue
+		}
+		if idx >= len(hc.counts) {
+			return nil, fmt.Errorf("counts index %d is out of range", idx)
+		}
+		hc.counts[idx] = count
+		idx++
+	}
+	return hc, nil
+}
+
+// HlogInterval is a histogram of a single interval of the log.
+type HlogInterval struct {
+	Tag string
+	// Start of the interval and its length in seconds, start is absolute
+	// if log has StartTime or BaseTime.
+	Start, Length float64
+	Max           float64
+
+	counts *hdrCounts
+}
+
+// Buckets returns recorded values, every bucket is represented by
+// its median value.
+func (iv *HlogInterval) Buckets() []Bucket {
+	return iv.counts.buckets()
+}
+
+// SignificantFigures returns precision the histogram was recorded with.
+func (iv *HlogInterval) SignificantFigures() int64 {
+	return int64(iv.counts.sigfigs)
+}
+
+// Dataset reconstructs values of the interval from bucket medians.
+func (iv *HlogInterval) Dataset(name string) *Dataset {
+	values := make([]float64, 0)
+	for _, b := range iv.Buckets() {
+		for i := int64(0); i < b.Count; i++ {
+			values = append(values, b.Value)
+		}
+	}
+	return NewDataset(name, values, math.Inf(-1), math.Inf(1))
+}
+
+// Histogram returns HDR histogram of the interval.
+func (iv *HlogInterval) Histogram() (Histogram, error) {
+	hc := iv.counts
+	scaleToInt := 1.0
+	if hc.ratio != 0 {
+		scaleToInt = 1 / hc.ratio
+	}
+	// median of the top bucket may be above highest trackable value
+	highest := hc.highest
+	for idx, count := range hc.counts {
+		if lowest, size := hc.valueRange(idx); count != 0 && lowest+size>>1 > highest {
+			highest = lowest + size>>1
+		}
+	}
+	hist, err := NewHdrHist(hc.lowest, highest, int(hc.sigfigs), scaleToInt)
+	if err != nil {
+		return nil, err
+	}
+	merged := hist.(*hdrHistogram).merged
+	for idx, count := range hc.counts {
+		if count == 0 {
+			continue
+		}
+		lowest, size := hc.valueRange(idx)
+		if err := merged.RecordValues(lowest+size>>1, count); err != nil {
+			return nil, err
+		}
+	}
+	return hist, nil
+}
+
+// hlogRelativeAge is how long before StartTime the first timestamp must be
+// to be taken as relative to it, same as Java HistogramLogReader.
+const hlogRelativeAge = 365 * 24 * 3600.0
+
+// ReadHlog reads all intervals of HdrHistogram interval log. Timestamps
+// are relative to BaseTime if the log has it, otherwise they are taken
+// as relative to StartTime if the first one is over a year before it
+// and as absolute if it isn't.
+func ReadHlog(r io.Reader) ([]*HlogInterval, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	startTime, baseTime := 0.0, 0.0
+	hasBaseTime := false
+	intervals := make([]*HlogInterval, 0)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "#[StartTime: "), strings.HasPrefix(text, "#[BaseTime: "):
+			fields := strings.Fields(text[strings.Index(text, ":")+1:])
+			if len(fields) > 0 {
+				v, err := strconv.ParseFloat(fields[0], 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				if strings.HasPrefix(text, "#[BaseTime: ") {
+					baseTime, hasBaseTime = v, true
+				} else {
+					startTime = v
+				}
+			}
+			continue
+		case strings.HasPrefix(text, "#"), strings.HasPrefix(text, "\""):
+			// comments and column names
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		iv := &HlogInterval{}
+		if strings.HasPrefix(fields[0], "Tag=") {
+			iv.Tag = strings.TrimPrefix(fields[0], "Tag=")
+			fields = fields[1:]
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 fields, got %d", line, len(fields))
+		}
+		var numbers [3]float64
+		for i := range numbers {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			numbers[i] = v
+		}
+		if !hasBaseTime {
+			if numbers[0] < startTime-hlogRelativeAge {
+				baseTime = startTime
+			}
+			hasBaseTime = true
+		}
+		iv.Start, iv.Length, iv.Max = baseTime+numbers[0], numbers[1], numbers[2]
+		data, err := base64.StdEncoding.DecodeString(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if iv.counts, err = decodeHdrCounts(data); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		intervals = append(intervals, iv)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return intervals, nil
+}
+
+// HlogDatasets reconstructs one dataset per tag, intervals are
+// concatenated in order of appearance.
+func HlogDatasets(name string, intervals []*HlogInterval) []*Dataset {
+	tags := make([]string, 0)
+	values := make(map[string][]float64)
+	for _, iv := range intervals {
+		if _, ok := values[iv.Tag]; !ok {
+			tags = append(tags, iv.Tag)
+		}
+		values[iv.Tag] = append(values[iv.Tag], iv.Dataset(iv.Tag).dataset...)
+	}
+	ds := make([]*Dataset, len(tags))
+	for i, tag := range tags {
+		dsName := name
+		if tag != "" {
+			dsName = name + "/" + tag
+		}
+		ds[i] = NewDataset(dsName, values[tag], math.Inf(-1), math.Inf(1))
+	}
+	return ds
+}
+
+// HlogWriter writes HdrHistogram interval log.
+type HlogWriter struct {
+	w          io.Writer
+	sigfigs    int32
+	scaleToInt float64
+	header     bool
+	startTime  time.Time
+}
+
+// NewHlogWriter creates log writer, histograms are written with
+// given precision, values are scaled to integers by scaleToInt.
+func NewHlogWriter(w io.Writer, startTime time.Time, sigfigs int, scaleToInt float64) *HlogWriter {
+	return &HlogWriter{
+		w:          w,
+		sigfigs:    int32(sigfigs),
+		scaleToInt: scaleToInt,
+		startTime:  startTime,
+	}
+}
+
+func (hw *HlogWriter) writeHeader() error {
+	start := float64(hw.startTime.UnixNano()) / 1e9
+	_, err := fmt.Fprintf(hw.w, "#[Histogram log format version %s]\n"+
+		"#[StartTime: %.3f (seconds since epoch), %s]\n"+
+		"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n",
+		hlogFormatVersion, start, hw.startTime.Format(time.UnixDate))
+	hw.header = true
+	return err
+}
+
+// WriteInterval writes histogram of values recorded during interval starting
+// at start seconds since start time. Negative values can't be stored
+// and are clamped to 0.
+func (hw *HlogWriter) WriteInterval(tag string, start, length float64, buckets []Bucket) error {
+	if !hw.header {
+		if err := hw.writeHeader(); err != nil {
+			return err
+		}
+	}
+	max := 0.0
+	for _, b := range buckets {
+		if b.Count > 0 && b.Value > max {
+			max = b.Value
+		}
+	}
+	highest := int64(Round(max * hw.scaleToInt))
+	if highest < 2 {
+		highest = 2
+	}
+	hc, err := newHdrCounts(1, highest, hw.sigfigs, 1/hw.scaleToInt)
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		v := int64(Round(b.Value * hw.scaleToInt))
+		if v < 0 {
+			v = 0
+		}
+		if err := hc.record(v, b.Count); err != nil {
+			return err
+		}
+	}
+	encoded, err := hc.encode()
+	if err != nil {
+		return err
+	}
+	if tag != "" {
+		if _, err := fmt.Fprintf(hw.w, "Tag=%s,", tag); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(hw.w, "%.3f,%.3f,%.3f,%s\n", start, length, max,
+		base64.StdEncoding.EncodeToString(encoded))
+	return err
+}
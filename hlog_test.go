@@ -0,0 +1,137 @@
+package hdrbench
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHlogZigZag(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 63, -64, 1 << 20, -(1 << 40), 1<<62 + 5, -1 << 63} {
+		buf := new(bytes.Buffer)
+		putZigZag(buf, v)
+		decoded, err := getZigZag(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, v, decoded)
+		assert.True(t, buf.Len() <= 9)
+	}
+}
+
+func TestHlogRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	ds := NewLatencyDataset("ds", rnd.Int63(), rnd.Int63(), 1.0, 1200.0, 1000)
+	phist, _ := NewPreceiseHist()
+	require.NoError(t, phist.RecordValues([]*Dataset{ds}, 0, 1000))
+
+	buf := new(bytes.Buffer)
+	w := NewHlogWriter(buf, time.Unix(1500000000, 0), 3, 100.0)
+	require.NoError(t, w.WriteInterval("first", 0, 1, phist.Buckets()))
+	require.NoError(t, w.WriteInterval("second", 1, 1, phist.Buckets()))
+
+	intervals, err := ReadHlog(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	require.Len(t, intervals, 2)
+	assert.Equal(t, "second", intervals[1].Tag)
+	fuzzyEquals(t, 1500000001.0, intervals[1].Start)
+
+	restored := intervals[0].Dataset("restored")
+	assert.Equal(t, 1000, restored.Len())
+	quantiles := []float64{0.1, 0.5, 0.9, 0.99}
+	phistQ, _ := phist.Quantiles(quantiles)
+	restoredHist, _ := NewPreceiseHist()
+	require.NoError(t, restoredHist.RecordValues([]*Dataset{restored}, 0, 1000))
+	restoredQ, _ := restoredHist.Quantiles(quantiles)
+	for _, diff := range DiffRelative(phistQ, restoredQ) {
+		require.InDelta(t, 0.0, diff, 0.001)
+	}
+
+	hist, err := intervals[1].Histogram()
+	require.NoError(t, err)
+	histQ, _ := hist.Quantiles(quantiles)
+	for _, diff := range DiffRelative(phistQ, histQ) {
+		require.InDelta(t, 0.0, diff, 0.01)
+	}
+}
+
+func TestHlogDecode(t *testing.T) {
+	// values 1, 2, 3, 1000, 1000000 recorded with 3 significant figures,
+	// V2 encoding is built by hand to not depend on the encoder
+	payload := []byte{
+		0x00,             // idx 0
+		0x02, 0x02, 0x02, // idx 1..3
+		0xc7, 0x0f, // 996 zeros
+		0x02,             // idx 1000
+		0xef, 0x9e, 0x01, // 10168 zeros
+		0x02, // idx 11169, 1000000 is in [999936, 1000448)
+	}
+	encoded := new(bytes.Buffer)
+	for _, field := range []interface{}{
+		int32(0x1c849313), int32(len(payload)), int32(0), int32(3),
+		int64(1), int64(3600000000), float64(1.0),
+	} {
+		require.NoError(t, binary.Write(encoded, binary.BigEndian, field))
+	}
+	encoded.Write(payload)
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	_, _ = zw.Write(encoded.Bytes())
+	require.NoError(t, zw.Close())
+	data := new(bytes.Buffer)
+	_ = binary.Write(data, binary.BigEndian, int32(0x1c849314))
+	_ = binary.Write(data, binary.BigEndian, int32(compressed.Len()))
+	data.Write(compressed.Bytes())
+
+	log := "#[StartTime: 1500000000.000 (seconds since epoch)]\n" +
+		"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n" +
+		"Tag=java,0.000,1.000,1.000," + base64.StdEncoding.EncodeToString(data.Bytes()) + "\n"
+	intervals, err := ReadHlog(strings.NewReader(log))
+	require.NoError(t, err)
+	require.Len(t, intervals, 1)
+	assert.Equal(t, "java", intervals[0].Tag)
+	assert.Equal(t, int64(3), intervals[0].SignificantFigures())
+	values := make([]float64, 0)
+	for _, b := range intervals[0].Buckets() {
+		values = append(values, b.Value)
+		assert.Equal(t, int64(1), b.Count)
+	}
+	assert.Equal(t, []float64{1, 2, 3, 1000, 1000192}, values)
+
+	// encoder produces the same payload
+	reencoded, err := intervals[0].counts.encode()
+	require.NoError(t, err)
+	decoded, err := decodeHdrCounts(reencoded)
+	require.NoError(t, err)
+	assert.Equal(t, intervals[0].counts.counts, decoded.counts)
+}
+
+func TestHlogTimestamps(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewHlogWriter(buf, time.Unix(1500000000, 0), 3, 100.0)
+	require.NoError(t, w.WriteInterval("", 0, 1, []Bucket{{Value: 1, Count: 1}}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	payload := lines[len(lines)-1][strings.LastIndex(lines[len(lines)-1], ",")+1:]
+	header := "#[StartTime: 1500000000.000 (seconds since epoch)]\n"
+	for _, c := range []struct {
+		name, log string
+		start     float64
+	}{
+		{"relative", header + "10.000,1.000,1.000," + payload, 1500000010},
+		{"absolute", header + "1500000010.000,1.000,1.000," + payload, 1500000010},
+		{"base time", header + "#[BaseTime: 1400000000.000 (seconds since epoch)]\n" +
+			"10.000,1.000,1.000," + payload, 1400000010},
+		{"no start time", "10.000,1.000,1.000," + payload, 10},
+	} {
+		intervals, err := ReadHlog(strings.NewReader(c.log))
+		require.NoError(t, err, c.name)
+		require.Len(t, intervals, 1, c.name)
+		assert.Equal(t, c.start, intervals[0].Start, c.name)
+	}
+}
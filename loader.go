@@ -0,0 +1,186 @@
+package hdrbench
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadOptions describes how to turn recorded values into datasets.
+type LoadOptions struct {
+	// Column with values, zero based index or column name if Header is set.
+	ValueColumn string
+	// Column values are grouped into datasets by, one dataset per
+	// distinct key. Empty puts all values into a single dataset.
+	KeyColumn string
+	// First row contains column names.
+	Header bool
+	// Values are multiplied by Scale, e.g. 0.001 to load microseconds
+	// as milliseconds. Zero means no conversion.
+	Scale float64
+	// CSV field delimiter, ',' if zero.
+	Comma rune
+}
+
+// LoadFile loads datasets from CSV (.csv, .tsv), HdrHistogram interval log
+// (.hlog) or newline-delimited (any other extension) file, optionally gzip
+// compressed (.gz). Datasets are named after the file and the key,
+// interval logs produce a dataset per tag and ignore opts.
+func LoadFile(fname string, opts LoadOptions) ([]*Dataset, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	ext := filepath.Ext(fname)
+	if ext == ".gz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+		ext = filepath.Ext(strings.TrimSuffix(fname, ext))
+	}
+	name := strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+	name = strings.TrimSuffix(name, ext)
+	switch ext {
+	case ".csv":
+		return LoadCSV(name, r, opts)
+	case ".hlog":
+		intervals, err := ReadHlog(r)
+		if err != nil {
+			return nil, err
+		}
+		return HlogDatasets(name, intervals), nil
+	case ".tsv":
+		if opts.Comma == 0 {
+			opts.Comma = '\t'
+		}
+		return LoadCSV(name, r, opts)
+	default:
+		return LoadLines(name, r, opts)
+	}
+}
+
+// LoadCSV loads datasets from CSV formatted records.
+func LoadCSV(name string, r io.Reader, opts LoadOptions) ([]*Dataset, error) {
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	return loadRecords(name, reader.Read, opts)
+}
+
+// LoadLines loads datasets from newline-delimited records,
+// fields of a record are separated by whitespace. Empty lines and lines
+// starting with '#' are skipped.
+func LoadLines(name string, r io.Reader, opts LoadOptions) ([]*Dataset, error) {
+	scanner := bufio.NewScanner(r)
+	read := func() ([]string, error) {
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			return strings.Fields(line), nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return loadRecords(name, read, opts)
+}
+
+func loadRecords(name string, read func() ([]string, error), opts LoadOptions) ([]*Dataset, error) {
+	var header []string
+	if opts.Header {
+		var err error
+		if header, err = read(); err != nil {
+			return nil, fmt.Errorf("unable to read header: %v", err)
+		}
+	}
+	valueIdx, err := columnIndex(opts.ValueColumn, header)
+	if err != nil {
+		return nil, err
+	}
+	keyIdx := -1
+	if opts.KeyColumn != "" {
+		if keyIdx, err = columnIndex(opts.KeyColumn, header); err != nil {
+			return nil, err
+		}
+	}
+	scale := opts.Scale
+	if scale == 0 {
+		scale = 1.0
+	}
+
+	keys := make([]string, 0)
+	values := make(map[string][]float64)
+	for row := 1; ; row++ {
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if valueIdx >= len(record) || keyIdx >= len(record) {
+			return nil, fmt.Errorf("record %d: got only %d fields", row, len(record))
+		}
+		v, err := strconv.ParseFloat(record[valueIdx], 64)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", row, err)
+		}
+		key := ""
+		if keyIdx >= 0 {
+			key = record[keyIdx]
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = append(values[key], v*scale)
+	}
+
+	ds := make([]*Dataset, len(keys))
+	for i, key := range keys {
+		dsName := name
+		if key != "" {
+			dsName = name + "/" + key
+		}
+		ds[i] = NewDataset(dsName, values[key], math.Inf(-1), math.Inf(1))
+	}
+	return ds, nil
+}
+
+// columnIndex resolves column given by index or by name in header.
+func columnIndex(column string, header []string) (int, error) {
+	if column == "" {
+		return 0, nil
+	}
+	if idx, err := strconv.Atoi(column); err == nil {
+		if idx < 0 {
+			return 0, fmt.Errorf("negative column index %d", idx)
+		}
+		return idx, nil
+	}
+	for idx, name := range header {
+		if name == column {
+			return idx, nil
+		}
+	}
+	return 0, fmt.Errorf("column %q not found", column)
+}
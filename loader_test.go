@@ -0,0 +1,72 @@
+package hdrbench
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const loaderCSV = `ts,host,latency_us
+1,a,1500
+2,b,2500
+3,a,500
+4,b,100
+`
+
+func TestLoadCSV(t *testing.T) {
+	ds, err := LoadCSV("req", strings.NewReader(loaderCSV), LoadOptions{
+		ValueColumn: "latency_us",
+		KeyColumn:   "host",
+		Header:      true,
+		Scale:       0.001,
+	})
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, "req/a", ds[0].name)
+	assert.Equal(t, []float64{1.5, 0.5}, ds[0].dataset)
+	assert.Equal(t, "req/b", ds[1].name)
+	fuzzyEquals(t, 2.5, ds[1].Max())
+	fuzzyEquals(t, 0.1, ds[1].Min())
+
+	_, err = LoadCSV("req", strings.NewReader(loaderCSV), LoadOptions{
+		ValueColumn: "missing", Header: true})
+	assert.Error(t, err)
+}
+
+func TestLoadLines(t *testing.T) {
+	ds, err := LoadLines("lines", strings.NewReader("# comment\n1.5 x\n\n2.5 y\n3 x\n"),
+		LoadOptions{KeyColumn: "1"})
+	require.NoError(t, err)
+	require.Len(t, ds, 2)
+	assert.Equal(t, []float64{1.5, 3}, ds[0].dataset)
+	assert.Equal(t, []float64{2.5}, ds[1].dataset)
+
+	_, err = LoadLines("lines", strings.NewReader("1.5\nabc\n"), LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadFileGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdrbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "latency.csv.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(loaderCSV))
+	require.NoError(t, gz.Close())
+	require.NoError(t, ioutil.WriteFile(fname, buf.Bytes(), 0644))
+
+	ds, err := LoadFile(fname, LoadOptions{ValueColumn: "2", Header: true})
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, "latency", ds[0].name)
+	assert.Equal(t, 4, ds[0].Len())
+}
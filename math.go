@@ -1,17 +1,23 @@
 package hdrbench
 
 import (
-	"github.com/golang/glog"
+	"fmt"
 	"math"
 	"math/rand"
 	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
 )
 
-func Sum(numbers []float64) (total float64) {
+// Sum of numbers with compensated summation.
+func Sum(numbers []float64) float64 {
+	var total CompensatedSum
 	for _, x := range numbers {
-		total += x
+		total.Add(x)
 	}
-	return total
+	return total.Value()
 }
 
 func Mean(numbers []float64) float64 {
@@ -27,6 +33,65 @@ func Median(numbers []float64) float64 {
 	return result
 }
 
+// MAD is median absolute deviation of sorted numbers from their median.
+func MAD(sorted []float64) float64 {
+	median := Median(sorted)
+	deviations := make([]float64, len(sorted))
+	for i, x := range sorted {
+		deviations[i] = math.Abs(x - median)
+	}
+	return Median(RadixSortFloat(deviations))
+}
+
+// TrimmedMean is mean of sorted numbers without proportion of
+// the smallest and proportion of the largest ones.
+func TrimmedMean(sorted []float64, proportion float64) float64 {
+	k := trimCount(len(sorted), proportion)
+	return Mean(sorted[k : len(sorted)-k])
+}
+
+// WinsorizedMean is mean of sorted numbers where proportion of the smallest
+// and of the largest ones are replaced by the closest remaining ones.
+func WinsorizedMean(sorted []float64, proportion float64) float64 {
+	k := trimCount(len(sorted), proportion)
+	var total CompensatedSum
+	total.Add(float64(k) * (sorted[k] + sorted[len(sorted)-k-1]))
+	for _, x := range sorted[k : len(sorted)-k] {
+		total.Add(x)
+	}
+	return total.Value() / float64(len(sorted))
+}
+
+// trimCount is number of numbers trimmed from every end, at least
+// one number is left.
+func trimCount(n int, proportion float64) int {
+	k := int(float64(n) * proportion)
+	if 2*k >= n {
+		k = (n - 1) / 2
+	}
+	return k
+}
+
+// HillTailIndex is Hill estimator of tail index alpha of sorted numbers
+// from k largest of them, smaller alpha means heavier tail, e.g.
+// variance is infinite below 2. It's NaN unless 0 < k < len(sorted) and
+// the numbers in the tail are positive.
+func HillTailIndex(sorted []float64, k int) float64 {
+	n := len(sorted)
+	if k < 1 || k >= n || sorted[n-k-1] <= 0 {
+		return math.NaN()
+	}
+	threshold := math.Log(sorted[n-k-1])
+	var total CompensatedSum
+	for _, x := range sorted[n-k:] {
+		total.Add(math.Log(x) - threshold)
+	}
+	if total.Value() == 0 {
+		return math.Inf(1)
+	}
+	return float64(k) / total.Value()
+}
+
 func Mode(numbers []float64) (modes []float64) {
 	frequencies := make(map[float64]int, len(numbers))
 	highestFrequency := 0
@@ -48,22 +113,219 @@ func Mode(numbers []float64) (modes []float64) {
 	return modes
 }
 
+// StdDev is sample standard deviation of numbers, 0 for less than 2 numbers.
 func StdDev(numbers []float64, mean float64) float64 {
-	total := 0.0
+	if len(numbers) < 2 {
+		return 0
+	}
+	var total CompensatedSum
 	for _, number := range numbers {
-		total += math.Pow(number-mean, 2)
+		total.Add((number - mean) * (number - mean))
 	}
-	variance := total / float64(len(numbers)-1)
+	variance := total.Value() / float64(len(numbers)-1)
 	return math.Sqrt(variance)
 }
 
+// CompensatedSum adds numbers with Neumaier's variant of Kahan summation,
+// error doesn't grow with number of added values. Zero value is 0.
+type CompensatedSum struct {
+	sum, compensation float64
+}
+
+func (cs *CompensatedSum) Add(x float64) {
+	t := cs.sum + x
+	if math.Abs(cs.sum) >= math.Abs(x) {
+		cs.compensation += (cs.sum - t) + x
+	} else {
+		cs.compensation += (x - t) + cs.sum
+	}
+	cs.sum = t
+}
+
+// Merge adds sum of other numbers.
+func (cs *CompensatedSum) Merge(other CompensatedSum) {
+	cs.Add(other.sum)
+	cs.compensation += other.compensation
+}
+
+func (cs CompensatedSum) Value() float64 {
+	return cs.sum + cs.compensation
+}
+
+// Summary accumulates exact statistics of values in a single pass: count,
+// compensated sum, mean and central moments up to the fourth by Welford's
+// algorithm generalized by Pebay, min and max.
+// Summaries of parts of values are combined by Merge. Zero value is
+// a summary of no values.
+type Summary struct {
+	count  int64
+	weight float64
+	sum    CompensatedSum
+	// values are shifted by the first one, so rounding errors of mean
+	// are relative to spread of values rather than to their magnitude
+	shift float64
+	mean  float64
+	// sums of powers of differences from mean
+	m2, m3, m4 float64
+	min, max   float64
+}
+
+// NewSummary returns summary of values.
+func NewSummary(values []float64) Summary {
+	var s Summary
+	for _, v := range values {
+		s.Add(v)
+	}
+	return s
+}
+
+func (s *Summary) Add(v float64) {
+	s.AddWeighted(v, 1)
+}
+
+// AddWeighted adds v standing for weight values.
+func (s *Summary) AddWeighted(v, weight float64) {
+	s.Merge(Summary{
+		count:  1,
+		weight: weight,
+		sum:    CompensatedSum{sum: v * weight},
+		shift:  v,
+		min:    v,
+		max:    v,
+	})
+}
+
+// Merge adds summary of other values, pairwise update of Chan et al.
+// extended to higher moments by Pebay, adding a single value is Welford's
+// update.
+func (s *Summary) Merge(other Summary) {
+	if other.count == 0 {
+		return
+	}
+	if s.count == 0 {
+		*s = other
+		return
+	}
+	na, nb := s.weight, other.weight
+	n := na + nb
+	delta := other.mean + (other.shift - s.shift) - s.mean
+	deltaN := delta / n
+	m2, m3 := s.m2, s.m3
+	s.m4 += other.m4 + delta*deltaN*deltaN*deltaN*na*nb*(na*na-na*nb+nb*nb) +
+		6*deltaN*deltaN*(na*na*other.m2+nb*nb*m2) + 4*deltaN*(na*other.m3-nb*m3)
+	s.m3 += other.m3 + delta*deltaN*deltaN*na*nb*(na-nb) + 3*deltaN*(na*other.m2-nb*m2)
+	s.m2 += other.m2 + delta*deltaN*na*nb
+	s.mean += deltaN * nb
+	s.weight = n
+	s.count += other.count
+	s.sum.Merge(other.sum)
+	s.min = math.Min(s.min, other.min)
+	s.max = math.Max(s.max, other.max)
+}
+
+// Count is number of added values.
+func (s Summary) Count() int64 {
+	return s.count
+}
+
+// Weight is total weight of added values, equals to Count
+// unless weighted values were added.
+func (s Summary) Weight() float64 {
+	return s.weight
+}
+
+// Sum is sum of values multiplied by their weights.
+func (s Summary) Sum() float64 {
+	return s.sum.Value()
+}
+
+// Mean is NaN for no values.
+func (s Summary) Mean() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.shift + s.mean
+}
+
+// Variance is sample variance, 0 for less than 2 values.
+func (s Summary) Variance() float64 {
+	if s.count < 2 || s.weight <= 1 {
+		return 0
+	}
+	return s.m2 / (s.weight - 1)
+}
+
+func (s Summary) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Skewness is sample skewness g1, 0 if all values are equal.
+func (s Summary) Skewness() float64 {
+	if s.m2 == 0 {
+		return 0
+	}
+	return math.Sqrt(s.weight) * s.m3 / math.Pow(s.m2, 1.5)
+}
+
+// Kurtosis is sample excess kurtosis g2, 0 for normal distribution
+// and if all values are equal.
+func (s Summary) Kurtosis() float64 {
+	if s.m2 == 0 {
+		return 0
+	}
+	return s.weight*s.m4/(s.m2*s.m2) - 3
+}
+
+// Min is +Inf for no values.
+func (s Summary) Min() float64 {
+	if s.count == 0 {
+		return math.Inf(1)
+	}
+	return s.min
+}
+
+// Max is -Inf for no values.
+func (s Summary) Max() float64 {
+	if s.count == 0 {
+		return math.Inf(-1)
+	}
+	return s.max
+}
+
 func Quantile(numbers []float64, n float64) (float64, int64) {
-	l := int64(len(numbers))
-	position := Round(float64(l) * n)
+	position := quantilePosition(int64(len(numbers)), n)
+	return numbers[int(position)], position
+}
+
+// quantilePosition is index of quantile n in l sorted values.
+func quantilePosition(l int64, n float64) int64 {
+	position := quantileRank(float64(l), n)
 	if position >= l {
 		position = l - 1
 	}
-	return numbers[int(position)], int64(position)
+	return position
+}
+
+// quantileRank is index of nearest rank of quantile n in values of total
+// weight: the smallest value covering at least n of the weight.
+func quantileRank(total float64, n float64) int64 {
+	// n isn't exact in binary, so integer ranks may end up just above
+	// themselves, e.g. 100 * 0.07 is 7.000000000000001
+	rank := int64(math.Ceil(nearestInteger(total*n))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return rank
+}
+
+// nearestInteger rounds x to integer if it's within a few ULPs of it,
+// as a product of a count and a decimal quantile is off by rounding only.
+func nearestInteger(x float64) float64 {
+	r := math.Floor(x + 0.5)
+	if ulp := math.Nextafter(math.Abs(x), math.Inf(1)) - math.Abs(x); math.Abs(x-r) <= 4*ulp {
+		return r
+	}
+	return x
 }
 
 func Quantiles(numbers []float64, n []float64) []float64 {
@@ -74,6 +336,150 @@ func Quantiles(numbers []float64, n []float64) []float64 {
 	return result
 }
 
+// QuantileMethod is a definition of sample quantile, see Hyndman and Fan,
+// Sample Quantiles in Statistical Packages, 1996.
+type QuantileMethod int
+
+const (
+	// NativeQuantiles is own definition of every backend, nearest rank
+	// x[ceil(n*q)] (same as InvertedCDF) for Precise histogram and Quantile.
+	NativeQuantiles QuantileMethod = iota
+	// InvertedCDF is Hyndman-Fan type 1, x[ceil(n*q)].
+	InvertedCDF
+	// AveragedInvertedCDF is type 2, type 1 averaged at discontinuities.
+	AveragedInvertedCDF
+	// ClosestObservation is type 3, x[n*q] rounded half to even.
+	ClosestObservation
+	// InterpolatedInvertedCDF is type 4, linear interpolation of ECDF.
+	InterpolatedInvertedCDF
+	// Hazen is type 5, piecewise linear with knots at (k-0.5)/n.
+	Hazen
+	// Weibull is type 6, knots at k/(n+1).
+	Weibull
+	// Linear is type 7, knots at (k-1)/(n-1), default of R and numpy.
+	Linear
+	// MedianUnbiased is type 8, recommended by Hyndman and Fan.
+	MedianUnbiased
+	// NormalUnbiased is type 9, unbiased for normally distributed values.
+	NormalUnbiased
+)
+
+var quantileMethodNames = []string{"native", "inverted-cdf", "averaged-inverted-cdf",
+	"closest-observation", "interpolated-inverted-cdf", "hazen", "weibull", "linear",
+	"median-unbiased", "normal-unbiased"}
+
+func (m QuantileMethod) String() string {
+	if m < 0 || int(m) >= len(quantileMethodNames) {
+		return "QuantileMethod(" + strconv.Itoa(int(m)) + ")"
+	}
+	return quantileMethodNames[m]
+}
+
+// ParseQuantileMethod parses method either by name or by Hyndman-Fan type 1-9.
+func ParseQuantileMethod(spec string) (QuantileMethod, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	for m, name := range quantileMethodNames {
+		if spec == name {
+			return QuantileMethod(m), nil
+		}
+	}
+	if m, err := strconv.Atoi(strings.TrimPrefix(spec, "type")); err == nil && m >= 1 && m <= 9 {
+		return QuantileMethod(m), nil
+	}
+	return NativeQuantiles, fmt.Errorf("unknown quantile method %q", spec)
+}
+
+// quantileInterpolation returns index lower of quantile q in n sorted values
+// and fraction of the way to the next value, quantile is
+// x[lower] + fraction*(x[lower+1]-x[lower]).
+func quantileInterpolation(n int64, q float64, method QuantileMethod) (lower int64, fraction float64) {
+	// ranks below are 1-based like in the paper
+	var h float64
+	switch method {
+	case InvertedCDF, AveragedInvertedCDF:
+		np := nearestInteger(float64(n) * q)
+		j := math.Floor(np)
+		switch {
+		case j < np:
+			h = j + 1
+		case method == AveragedInvertedCDF:
+			h, fraction = j, 0.5
+		default:
+			h = j
+		}
+	case ClosestObservation:
+		k := nearestInteger(float64(n)*q - 0.5)
+		j := math.Floor(k)
+		h = j + 1
+		if k == j && math.Mod(j, 2) == 0 {
+			h = j
+		}
+	case InterpolatedInvertedCDF:
+		h = float64(n) * q
+	case Hazen:
+		h = float64(n)*q + 0.5
+	case Weibull:
+		h = float64(n+1) * q
+	case Linear:
+		h = float64(n-1)*q + 1
+	case MedianUnbiased:
+		h = (float64(n)+1.0/3)*q + 1.0/3
+	case NormalUnbiased:
+		h = (float64(n)+0.25)*q + 3.0/8
+	default:
+		return quantilePosition(n, q), 0
+	}
+	if method >= InterpolatedInvertedCDF {
+		h = nearestInteger(h)
+		fraction = h - math.Floor(h)
+		h = math.Floor(h)
+	}
+	switch {
+	case h < 1:
+		return 0, 0
+	case h >= float64(n):
+		return n - 1, 0
+	}
+	return int64(h) - 1, fraction
+}
+
+// EstimateQuantiles returns quantiles n of sorted numbers by method.
+func EstimateQuantiles(numbers []float64, n []float64, method QuantileMethod) []float64 {
+	result := make([]float64, len(n))
+	for i, q := range n {
+		lower, fraction := quantileInterpolation(int64(len(numbers)), q, method)
+		result[i] = numbers[lower]
+		if fraction > 0 {
+			result[i] += fraction * (numbers[lower+1] - numbers[lower])
+		}
+	}
+	return result
+}
+
+// WeightedQuantiles returns quantiles of sorted numbers where every number
+// stands for its weight of values. With integer weights quantiles are the
+// same as Quantiles of numbers repeated weight times.
+func WeightedQuantiles(numbers, weights []float64, n []float64) []float64 {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, w := range weights {
+		total += w
+		cumulative[i] = total
+	}
+	result := make([]float64, len(n))
+	for i, v := range n {
+		rank := float64(quantileRank(total, v))
+		position := sort.Search(len(cumulative), func(j int) bool {
+			return cumulative[j] > rank
+		})
+		if position == len(numbers) {
+			position--
+		}
+		result[i] = numbers[position]
+	}
+	return result
+}
+
 func Diff(numbers []float64, numbersOther []float64) []float64 {
 	rv := make([]float64, len(numbers))
 	for i := range numbers {
@@ -82,6 +488,8 @@ func Diff(numbers []float64, numbersOther []float64) []float64 {
 	return rv
 }
 
+// DiffRelative returns relative errors of derived values. Values closer to
+// zero than epsilon are zeros, non-zero estimate of zero is 100% error.
 func DiffRelative(original []float64, derived []float64) []float64 {
 	if len(original) != len(derived) {
 		glog.Fatal("Expected same size of arrays")
@@ -89,15 +497,39 @@ func DiffRelative(original []float64, derived []float64) []float64 {
 	epsilon := 10e-16
 	rv := make([]float64, len(original))
 	for i := range original {
-		if original[i] < epsilon {
-			rv[i] = 0.0
-		} else {
+		switch {
+		case math.Abs(original[i]) >= epsilon:
 			rv[i] = math.Abs(derived[i]-original[i]) / math.Abs(original[i])
+		case math.Abs(derived[i]) < epsilon:
+			rv[i] = 0.0
+		default:
+			rv[i] = 1.0
 		}
 	}
 	return rv
 }
 
+// Bootstrap estimates confidence interval of statistic stat of numbers
+// with percentile bootstrap: numbers are resampled with replacement
+// resamples times and bounds are (1-confidence)/2 and (1+confidence)/2
+// quantiles of resampled statistics.
+func Bootstrap(rnd *rand.Rand, numbers []float64, stat func([]float64) float64,
+	resamples int, confidence float64) (lower, upper float64) {
+
+	stats := make([]float64, resamples)
+	sample := make([]float64, len(numbers))
+	for i := range stats {
+		for j := range sample {
+			sample[j] = numbers[rnd.Intn(len(numbers))]
+		}
+		stats[i] = stat(sample)
+	}
+	stats = QSortFloat(stats)
+	lower, _ = Quantile(stats, (1-confidence)/2)
+	upper, _ = Quantile(stats, (1+confidence)/2)
+	return lower, upper
+}
+
 // Go doesn't have Round function :(
 // https://github.com/golang/go/issues/4594
 func Round(n float64) int64 {
@@ -159,7 +591,8 @@ func Downsample(values []float64, step int, q []float64) []float64 {
 			case 0.0:
 				qvals = append(qvals, slice[0])
 			default:
-				qvals = append(qvals, Quantile(slice, qv))
+				value, _ := Quantile(slice, qv)
+				qvals = append(qvals, value)
 			}
 		}
 	}
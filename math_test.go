@@ -0,0 +1,141 @@
+package hdrbench
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootstrap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	numbers := make([]float64, 200)
+	for i := range numbers {
+		numbers[i] = rnd.NormFloat64() + 10
+	}
+	lower, upper := Bootstrap(rnd, numbers, Mean, 1000, 0.95)
+	mean := Mean(numbers)
+	assert.True(t, lower < mean && mean < upper, "%v not in [%v, %v]", mean, lower, upper)
+	// standard error of the mean is 1/sqrt(200), the interval is ~4 of them wide
+	assert.InDelta(t, 0.28, upper-lower, 0.07)
+
+	lower, upper = Bootstrap(rnd, []float64{3, 3, 3}, Mean, 100, 0.95)
+	assert.Equal(t, 3.0, lower)
+	assert.Equal(t, 3.0, upper)
+}
+
+func TestDiffRelative(t *testing.T) {
+	diff := DiffRelative([]float64{-2.0, 0.0, 0.0, 4.0}, []float64{-1.0, 0.0, 0.5, 5.0})
+	assert.Equal(t, []float64{0.5, 0.0, 1.0, 0.25}, diff)
+}
+
+func TestEstimateQuantiles(t *testing.T) {
+	numbers := []float64{1, 2, 3, 4, 5, 7, 11, 13, 17, 30}
+	quantiles := []float64{0, 0.1, 0.25, 0.3, 0.5, 0.77, 0.9, 1}
+	// quantile() of R with type = 1..9
+	expected := map[QuantileMethod][]float64{
+		InvertedCDF:             {1, 1, 3, 3, 5, 13, 17, 30},
+		AveragedInvertedCDF:     {1, 1.5, 3, 3.5, 6, 13, 23.5, 30},
+		ClosestObservation:      {1, 1, 2, 3, 5, 13, 17, 30},
+		InterpolatedInvertedCDF: {1, 1, 2.5, 3, 5, 12.4, 17, 30},
+		Hazen:                   {1, 1.5, 3, 3.5, 6, 13.8, 23.5, 30},
+		Weibull:                 {1, 1.1, 2.75, 3.3, 6, 14.88, 28.7, 30},
+		Linear:                  {1, 1.9, 3.25, 3.7, 6, 12.86, 18.3, 30},
+		MedianUnbiased:          {1, 1.366667, 2.916667, 3.433333, 6, 14.16, 25.233333, 30},
+		NormalUnbiased:          {1, 1.4, 2.9375, 3.45, 6, 14.07, 24.8, 30},
+	}
+	for method, values := range expected {
+		actual := EstimateQuantiles(numbers, quantiles, method)
+		for i := range values {
+			assert.InDelta(t, values[i], actual[i], 1e-6, "%v at %v", method, quantiles[i])
+		}
+	}
+	assert.Equal(t, Quantiles(numbers, quantiles), EstimateQuantiles(numbers, quantiles, NativeQuantiles))
+
+	method, err := ParseQuantileMethod("type7")
+	assert.NoError(t, err)
+	assert.Equal(t, Linear, method)
+	method, err = ParseQuantileMethod("hazen")
+	assert.NoError(t, err)
+	assert.Equal(t, Hazen, method)
+	_, err = ParseQuantileMethod("10")
+	assert.Error(t, err)
+}
+
+func TestCompensatedSum(t *testing.T) {
+	assert.Equal(t, 2.0, Sum([]float64{1, 1e100, 1, -1e100}))
+	tenths := make([]float64, 10)
+	for i := range tenths {
+		tenths[i] = 0.1
+	}
+	assert.Equal(t, 1.0, Sum(tenths))
+}
+
+func TestSummary(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	values := make([]float64, 100000)
+	for i := range values {
+		// large offset breaks naive sum of squares
+		values[i] = 1e9 + rnd.NormFloat64()*10
+	}
+	summary := NewSummary(values)
+	mean, variance := exactMeanVariance(values)
+	assert.Equal(t, int64(len(values)), summary.Count())
+	assert.InEpsilon(t, mean, summary.Mean(), 1e-15)
+	assert.InEpsilon(t, variance, summary.Variance(), 1e-12)
+	assert.InEpsilon(t, 100.0, summary.Variance(), 0.02)
+	sorted := QSortFloat(append([]float64(nil), values...))
+	assert.Equal(t, sorted[0], summary.Min())
+	assert.Equal(t, sorted[len(sorted)-1], summary.Max())
+
+	// summaries of parts merge into summary of the whole
+	var merged Summary
+	for start := 0; start < len(values); start += 30000 {
+		stop := start + 30000
+		if stop > len(values) {
+			stop = len(values)
+		}
+		merged.Merge(NewSummary(values[start:stop]))
+	}
+	assert.Equal(t, summary.Count(), merged.Count())
+	assert.InEpsilon(t, mean, merged.Mean(), 1e-15)
+	assert.InEpsilon(t, variance, merged.Variance(), 1e-12)
+	assert.InEpsilon(t, summary.Sum(), merged.Sum(), 1e-15)
+	assert.Equal(t, summary.Min(), merged.Min())
+	assert.Equal(t, summary.Max(), merged.Max())
+
+	// weighted value is the value repeated
+	var weighted Summary
+	weighted.AddWeighted(4, 3)
+	weighted.AddWeighted(7, 1)
+	repeated := NewSummary([]float64{4, 4, 4, 7})
+	assert.Equal(t, repeated.Weight(), weighted.Weight())
+	assert.InEpsilon(t, repeated.Mean(), weighted.Mean(), 1e-15)
+	assert.InEpsilon(t, repeated.Variance(), weighted.Variance(), 1e-15)
+
+	var empty Summary
+	assert.True(t, math.IsNaN(empty.Mean()))
+	assert.Equal(t, 0.0, empty.Variance())
+	assert.Equal(t, 0.0, NewSummary([]float64{5}).StdDev())
+	assert.Equal(t, 0.0, StdDev([]float64{5}, 5))
+}
+
+// exactMeanVariance calculates mean and sample variance with 256 bit floats.
+func exactMeanVariance(values []float64) (float64, float64) {
+	sum := new(big.Float).SetPrec(256)
+	for _, v := range values {
+		sum.Add(sum, big.NewFloat(v))
+	}
+	mean := new(big.Float).SetPrec(256).Quo(sum, big.NewFloat(float64(len(values))))
+	squares := new(big.Float).SetPrec(256)
+	for _, v := range values {
+		diff := new(big.Float).SetPrec(256).Sub(big.NewFloat(v), mean)
+		squares.Add(squares, diff.Mul(diff, diff))
+	}
+	variance := squares.Quo(squares, big.NewFloat(float64(len(values)-1)))
+	m, _ := mean.Float64()
+	v, _ := variance.Float64()
+	return m, v
+}
@@ -0,0 +1,174 @@
+// Package metrics measures accuracy of quantiles estimated by sketches
+// against exact values. Sketches give guarantees in different metrics:
+// relative value error, rank error or distance between distributions,
+// so every metric is computed from the same inputs: exact values sorted
+// in ascending order, quantiles, their exact values and values estimated
+// for them.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Func computes errors of estimates[i] of quantiles[i] over sorted exact
+// values. exact[i] is the reference value of quantiles[i], it's expected
+// to be estimated from sorted values the same way as the reference
+// quantiles errors are measured against (e.g. by Precise histogram with
+// the same quantile method), so metrics agree with them. Quantiles are
+// expected in ascending order.
+type Func func(sorted, quantiles, exact, estimates []float64) []float64
+
+// Metric is a named accuracy metric.
+type Metric struct {
+	Name string
+	// Pointwise metrics return error for every quantile,
+	// others a single distance between distributions.
+	Pointwise bool
+	// Errors are fractions to be reported as percents.
+	Percent bool
+	Compute Func
+}
+
+var (
+	// Absolute error of values.
+	Absolute = Metric{"absolute", true, false, absolute}
+	// Relative error of values, infinite if exact value is zero and
+	// estimate is not.
+	Relative = Metric{"relative", true, true, relative}
+	// Rank error, distance between quantile and normalized range of ranks
+	// estimated value occupies in exact values.
+	Rank = Metric{"rank", true, true, rank}
+	// Kolmogorov-Smirnov distance between exact and estimated CDF.
+	KS = Metric{"ks", false, true, ks}
+	// Wasserstein (earth mover) distance between exact and estimated
+	// distributions, in units of values.
+	Wasserstein = Metric{"wasserstein", false, false, wasserstein}
+	// Maximal relative error over the CDF.
+	MaxRelative = Metric{"max-relative", false, true, maxRelative}
+)
+
+// All metrics known by name.
+var All = []Metric{Absolute, Relative, Rank, KS, Wasserstein, MaxRelative}
+
+// Parse parses comma separated metric names.
+func Parse(spec string) ([]Metric, error) {
+	metrics := make([]Metric, 0)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, m := range All {
+			if m.Name == name {
+				metrics = append(metrics, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown metric %q", name)
+		}
+	}
+	return metrics, nil
+}
+
+func absolute(sorted, quantiles, exact, estimates []float64) []float64 {
+	errors := make([]float64, len(quantiles))
+	for i := range quantiles {
+		errors[i] = math.Abs(estimates[i] - exact[i])
+	}
+	return errors
+}
+
+func relative(sorted, quantiles, exact, estimates []float64) []float64 {
+	errors := make([]float64, len(quantiles))
+	for i := range quantiles {
+		e := exact[i]
+		switch {
+		case estimates[i] == e:
+			errors[i] = 0
+		case e == 0:
+			errors[i] = math.Inf(1)
+		default:
+			errors[i] = math.Abs(estimates[i]-e) / math.Abs(e)
+		}
+	}
+	return errors
+}
+
+func rank(sorted, quantiles, exact, estimates []float64) []float64 {
+	n := float64(len(sorted))
+	errors := make([]float64, len(quantiles))
+	for i, q := range quantiles {
+		// estimate occupies ranks (lower, upper] of exact values
+		lower := float64(sort.SearchFloat64s(sorted, estimates[i])) / n
+		upper := float64(cdfCount(sorted, estimates[i])) / n
+		switch {
+		case q < lower:
+			errors[i] = lower - q
+		case q > upper:
+			errors[i] = q - upper
+		}
+	}
+	return errors
+}
+
+// cdfCount is number of sorted values not greater than v.
+func cdfCount(sorted []float64, v float64) int {
+	return sort.Search(len(sorted), func(i int) bool { return sorted[i] > v })
+}
+
+// estimatedCDF is the step CDF of estimates: the greatest quantile which
+// estimate doesn't exceed v.
+func estimatedCDF(quantiles, estimates []float64, v float64) float64 {
+	cdf := 0.0
+	for i := range quantiles {
+		if estimates[i] <= v && quantiles[i] > cdf {
+			cdf = quantiles[i]
+		}
+	}
+	return cdf
+}
+
+func ks(sorted, quantiles, exact, estimates []float64) []float64 {
+	n := float64(len(sorted))
+	distance := 0.0
+	check := func(v float64) {
+		d := math.Abs(float64(cdfCount(sorted, v))/n - estimatedCDF(quantiles, estimates, v))
+		distance = math.Max(distance, d)
+	}
+	// both CDFs are step functions, so supremum is at one of the steps
+	for i, v := range sorted {
+		if i+1 < len(sorted) && sorted[i+1] == v {
+			continue
+		}
+		check(v)
+	}
+	for _, v := range estimates {
+		check(v)
+	}
+	return []float64{distance}
+}
+
+func wasserstein(sorted, quantiles, exact, estimates []float64) []float64 {
+	// integral of |exact(q) - estimate(q)| dq over quantile grid steps
+	distance := 0.0
+	prev := 0.0
+	for i, q := range quantiles {
+		distance += math.Abs(estimates[i]-exact[i]) * (q - prev)
+		prev = q
+	}
+	return []float64{distance}
+}
+
+func maxRelative(sorted, quantiles, exact, estimates []float64) []float64 {
+	max := 0.0
+	for _, e := range relative(sorted, quantiles, exact, estimates) {
+		max = math.Max(max, e)
+	}
+	return []float64{max}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sorted = []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+var quantiles = []float64{0.1, 0.5, 0.9, 1.0}
+
+// nearestRank is exact value of every quantile in sorted values.
+func nearestRank(sorted, quantiles []float64) []float64 {
+	exact := make([]float64, len(quantiles))
+	for i, q := range quantiles {
+		pos := int(math.Ceil(q*float64(len(sorted)))) - 1
+		if pos < 0 {
+			pos = 0
+		}
+		exact[i] = sorted[pos]
+	}
+	return exact
+}
+
+// grid is every rank of sorted values with estimates shifted by shift.
+func grid(shift float64) ([]float64, []float64) {
+	quantiles := make([]float64, len(sorted))
+	estimates := make([]float64, len(sorted))
+	for i, v := range sorted {
+		quantiles[i] = float64(i+1) / float64(len(sorted))
+		estimates[i] = v + shift
+	}
+	return quantiles, estimates
+}
+
+func TestExactEstimates(t *testing.T) {
+	quantiles, estimates := grid(0)
+	for _, m := range All {
+		for _, e := range m.Compute(sorted, quantiles, nearestRank(sorted, quantiles), estimates) {
+			assert.Equal(t, 0.0, e, m.Name)
+		}
+	}
+}
+
+func TestPointwise(t *testing.T) {
+	estimates := []float64{0, 7, 9, 10}
+	exact := nearestRank(sorted, quantiles)
+	assert.Equal(t, []float64{1, 2, 0, 0}, Absolute.Compute(sorted, quantiles, exact, estimates))
+	assert.Equal(t, []float64{1, 0.4, 0, 0}, Relative.Compute(sorted, quantiles, exact, estimates))
+	// reference of another quantile definition
+	assert.Equal(t, []float64{1, 1.5, 0, 0},
+		Absolute.Compute(sorted, quantiles, []float64{1, 5.5, 9, 10}, estimates))
+	rank := Rank.Compute(sorted, quantiles, exact, estimates)
+	assert.InDelta(t, 0.1, rank[0], 1e-9)
+	assert.InDelta(t, 0.1, rank[1], 1e-9)
+	assert.Equal(t, 0.0, rank[2])
+
+	zeros := []float64{0, 0, 1}
+	relative := Relative.Compute(zeros, []float64{0.5, 1}, []float64{0, 1}, []float64{1, 1})
+	assert.True(t, math.IsInf(relative[0], 1))
+	assert.Equal(t, 0.0, relative[1])
+}
+
+func TestDistances(t *testing.T) {
+	// every estimate is one value higher
+	quantiles, estimates := grid(1)
+	exact := nearestRank(sorted, quantiles)
+	assert.InDelta(t, 0.1, KS.Compute(sorted, quantiles, exact, estimates)[0], 1e-9)
+	assert.InDelta(t, 1.0, Wasserstein.Compute(sorted, quantiles, exact, estimates)[0], 1e-9)
+	assert.InDelta(t, 1.0, MaxRelative.Compute(sorted, quantiles, exact, estimates)[0], 1e-9)
+}
+
+func TestParse(t *testing.T) {
+	metrics, err := Parse("rank, ks")
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	require.Equal(t, "rank", metrics[0].Name)
+	require.Equal(t, "ks", metrics[1].Name)
+	_, err = Parse("rank,foo")
+	require.Error(t, err)
+}
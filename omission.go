@@ -0,0 +1,52 @@
+package hdrbench
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+// NewStalledDataset simulates closed-loop load generator sending a request
+// every interval and waiting for the response before sending the next one.
+// With probability stallProb a response is delayed by a stall in
+// [stallMin, stallMax), requests which should have been sent meanwhile are
+// never sent (coordinated omission).
+// Returns latencies observed by the load generator and latencies of an ideal
+// open-loop generator, which would have sent missed requests on schedule.
+func NewStalledDataset(name string, baseSeed, mixinSeed, stallSeed int64,
+	interval, stallProb, stallMin, stallMax float64, n int) (observed, expected *Dataset) {
+
+	base := NewLatencyDataset(name, baseSeed, mixinSeed, 1.0, interval/2, n)
+	stallRnd := rand.New(rand.NewSource(stallSeed))
+	observedValues := make([]float64, n)
+	expectedValues := make([]float64, 0, n)
+	for i, latency := range base.dataset {
+		if stallRnd.Float64() < stallProb {
+			latency += stallMin + stallRnd.Float64()*(stallMax-stallMin)
+		}
+		observedValues[i] = latency
+		// all requests scheduled before the response was received are
+		// waiting for the stall too
+		expectedValues = append(expectedValues, latency)
+		for missed := latency - interval; missed >= interval; missed -= interval {
+			expectedValues = append(expectedValues, missed)
+		}
+	}
+	return NewDataset(name, observedValues, interval/2, 1.0),
+		NewDataset(name, expectedValues, interval/2, 1.0)
+}
+
+// NewStalledDatasets creates observed and expected datasets for
+// given number of signals, see NewStalledDataset.
+func NewStalledDatasets(rnd *rand.Rand, n int, datasets int,
+	interval, stallProb, stallMin, stallMax float64) (observed, expected []*Dataset) {
+
+	observed = make([]*Dataset, datasets)
+	expected = make([]*Dataset, datasets)
+	mixinSeed := rnd.Int63()
+	for idx := 0; idx < datasets; idx++ {
+		observed[idx], expected[idx] = NewStalledDataset(
+			"stalled"+strconv.Itoa(idx), rnd.Int63(), mixinSeed, rnd.Int63(),
+			interval, stallProb, stallMin, stallMax, n)
+	}
+	return observed, expected
+}
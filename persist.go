@@ -0,0 +1,274 @@
+package hdrbench
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// Binary dataset format, all integers are big endian:
+//
+//	magic      "HBDS"
+//	version    uint8, 1
+//	flags      uint8, bit 0 is set if timestamps follow values,
+//	           bit 1 is set if weights follow them
+//	length     uint32, length of the payload
+//	payload    raw DEFLATE (RFC 1951) compressed:
+//	  name       uvarint length followed by UTF-8 bytes
+//	  upper      float64
+//	  lower      float64
+//	  count      uvarint
+//	  values     count uint64, IEEE 754 bits of a value XOR bits of the
+//	             previous one (0 for the first value)
+//	  timestamps count uint64 encoded as values, if flags bit 0 is set
+//	  weights    count uint64 encoded as values, if flags bit 1 is set
+//
+// Archive of datasets is
+//
+//	magic      "HBDA"
+//	version    uint8, 1
+//	count      uvarint
+//	datasets   count datasets in the format above
+const (
+	datasetMagic  = "HBDS"
+	archiveMagic  = "HBDA"
+	formatVersion = 1
+
+	flagTimestamps = 1
+	flagWeights    = 2
+
+	// lengths read from a file aren't trusted, values are read
+	// in chunks of at most readChunk
+	readChunk = 1 << 16
+)
+
+// WriteTo writes dataset in the compact binary format.
+func (fd *Dataset) WriteTo(w io.Writer) (int64, error) {
+	payload := new(bytes.Buffer)
+	fw, err := flate.NewWriter(payload, flate.BestCompression)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(fw)
+	writeUvarint(bw, uint64(len(fd.name)))
+	bw.WriteString(fd.name)
+	writeFloat(bw, fd.upperBound)
+	writeFloat(bw, fd.lowerBound)
+	writeUvarint(bw, uint64(len(fd.dataset)))
+	writeXorDelta(bw, fd.dataset)
+	flags := uint8(0)
+	if fd.timestamps != nil {
+		flags |= flagTimestamps
+		writeXorDelta(bw, fd.timestamps)
+	}
+	if fd.weights != nil {
+		flags |= flagWeights
+		writeXorDelta(bw, fd.weights)
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	if err := fw.Close(); err != nil {
+		return 0, err
+	}
+	if payload.Len() > math.MaxUint32 {
+		return 0, fmt.Errorf("%s: dataset is too large", fd.name)
+	}
+
+	header := make([]byte, 0, 10)
+	header = append(header, datasetMagic...)
+	header = append(header, formatVersion, flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[6:], uint32(payload.Len()))
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := payload.WriteTo(w)
+	return int64(n) + m, err
+}
+
+// ReadDataset reads dataset written by WriteTo.
+func ReadDataset(r io.Reader) (*Dataset, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != datasetMagic {
+		return nil, fmt.Errorf("not a dataset, magic %q", header[:4])
+	}
+	if header[4] != formatVersion {
+		return nil, fmt.Errorf("unsupported dataset version %d", header[4])
+	}
+	flags := header[5]
+	length := binary.BigEndian.Uint32(header[6:])
+
+	fr := flate.NewReader(io.LimitReader(r, int64(length)))
+	defer fr.Close()
+	br := bufio.NewReader(fr)
+	nameLen, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if nameLen > math.MaxInt64 {
+		return nil, fmt.Errorf("corrupt dataset, name of %d bytes", nameLen)
+	}
+	// the name grows as its bytes arrive
+	name := new(bytes.Buffer)
+	if _, err := io.CopyN(name, br, int64(nameLen)); err != nil {
+		return nil, fmt.Errorf("corrupt dataset, name of %d bytes: %v", nameLen, err)
+	}
+	var bounds [2]float64
+	if err := binary.Read(br, binary.BigEndian, bounds[:]); err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	values, err := readXorDelta(br, count)
+	if err != nil {
+		return nil, err
+	}
+	ds := NewDataset(name.String(), values, bounds[0], bounds[1])
+	if flags&flagTimestamps != 0 {
+		if ds.timestamps, err = readXorDelta(br, count); err != nil {
+			return nil, err
+		}
+	}
+	if flags&flagWeights != 0 {
+		weights, err := readXorDelta(br, count)
+		if err != nil {
+			return nil, err
+		}
+		ds.setWeights(weights)
+	}
+	// drain the rest of payload, so the next dataset could be read
+	if _, err := io.Copy(ioutil.Discard, br); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// WriteArchive writes datasets into archive.
+func WriteArchive(w io.Writer, datasets []*Dataset) error {
+	header := append([]byte(archiveMagic), formatVersion)
+	header = append(header, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutUvarint(header[5:], uint64(len(datasets)))
+	if _, err := w.Write(header[:5+n]); err != nil {
+		return err
+	}
+	for _, dataset := range datasets {
+		if _, err := dataset.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadArchive reads datasets written by WriteArchive.
+func ReadArchive(r io.Reader) ([]*Dataset, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != archiveMagic {
+		return nil, fmt.Errorf("not a datasets archive, magic %q", header[:4])
+	}
+	if header[4] != formatVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", header[4])
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	datasets := make([]*Dataset, 0)
+	for i := uint64(0); i < count; i++ {
+		ds, err := ReadDataset(br)
+		if err != nil {
+			return nil, fmt.Errorf("dataset %d: %v", i, err)
+		}
+		datasets = append(datasets, ds)
+	}
+	return datasets, nil
+}
+
+// SaveArchive writes datasets into archive file.
+func SaveArchive(fname string, datasets []*Dataset) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := WriteArchive(bw, datasets); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadArchive reads datasets from archive file.
+func LoadArchive(fname string) ([]*Dataset, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadArchive(f)
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func writeFloat(w *bufio.Writer, v float64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	w.Write(buf[:])
+}
+
+// writeXorDelta writes bits of every value XOR bits of the previous one,
+// slowly changing values share sign, exponent and high bits of mantissa,
+// so deltas have long runs of zeroes DEFLATE compresses well.
+func writeXorDelta(w *bufio.Writer, values []float64) {
+	var buf [8]byte
+	prev := uint64(0)
+	for _, v := range values {
+		bits := math.Float64bits(v)
+		binary.BigEndian.PutUint64(buf[:], bits^prev)
+		w.Write(buf[:])
+		prev = bits
+	}
+}
+
+// readXorDelta reads count values written by writeXorDelta, values grow
+// by chunks as they arrive, so corrupt count fails at the end of payload
+// instead of allocating all of them upfront.
+func readXorDelta(r io.Reader, count uint64) ([]float64, error) {
+	chunk := count
+	if chunk > readChunk {
+		chunk = readChunk
+	}
+	values := make([]float64, 0, chunk)
+	var buf [8]byte
+	prev := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, fmt.Errorf("corrupt dataset, value %d of %d: %v", i, count, err)
+		}
+		prev ^= binary.BigEndian.Uint64(buf[:])
+		values = append(values, math.Float64frombits(prev))
+	}
+	return values, nil
+}
@@ -0,0 +1,81 @@
+package hdrbench
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatasetWriteTo(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	ds := NewLatencyDatasets(rnd, 10000, 1, 0)[0]
+	buf := new(bytes.Buffer)
+	n, err := ds.WriteTo(buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	// random walk compresses below raw float64 size
+	require.True(t, buf.Len() < 8*10000, "%d bytes", buf.Len())
+
+	read, err := ReadDataset(buf)
+	require.NoError(t, err)
+	require.Equal(t, ds, read)
+
+	_, err = ReadDataset(bytes.NewReader([]byte("HBDX\x01\x00\x00\x00\x00\x00")))
+	require.Error(t, err)
+}
+
+// corruptDataset is an empty named dataset of zero bounds with lengths
+// of name and values not matching its payload, header claims length
+// of payload.
+func corruptDataset(length uint32, nameLen, count uint64) []byte {
+	payload := new(bytes.Buffer)
+	fw, _ := flate.NewWriter(payload, flate.BestCompression)
+	var buf [binary.MaxVarintLen64]byte
+	fw.Write(buf[:binary.PutUvarint(buf[:], nameLen)])
+	fw.Write(make([]byte, 16))
+	fw.Write(buf[:binary.PutUvarint(buf[:], count)])
+	fw.Close()
+	header := []byte("HBDS\x01\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint32(header[6:], length)
+	return append(header, payload.Bytes()...)
+}
+
+func TestReadCorruptDataset(t *testing.T) {
+	// forged lengths fail at the end of payload without allocating them
+	for _, length := range []uint32{0xFFFFFFFF, 40} {
+		_, err := ReadDataset(bytes.NewReader(corruptDataset(length, 1<<62, 0)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "name of")
+		_, err = ReadDataset(bytes.NewReader(corruptDataset(length, 0, 1<<38)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "value 0 of")
+		_, err = ReadDataset(bytes.NewReader(corruptDataset(length, 1<<63+1, 0)))
+		require.Error(t, err)
+	}
+	_, err := ReadArchive(bytes.NewReader(append([]byte("HBDA\x01\xff\xff\xff\xff\x0f"),
+		corruptDataset(0xFFFFFFFF, 1<<62, 0)...)))
+	require.Error(t, err)
+}
+
+func TestArchive(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewTimedLatencyDatasets(rnd, 1000, 3, 1, func() ArrivalProcess {
+		return &PoissonArrivals{Rate: 10}
+	})
+	datasets[1] = SampleDataset(rnd, datasets[1], 0, datasets[1].Len(), 0.3)
+	datasets = append(datasets, NewDataset("empty", nil, 0, 0))
+	buf := new(bytes.Buffer)
+	require.NoError(t, WriteArchive(buf, datasets))
+	read, err := ReadArchive(buf)
+	require.NoError(t, err)
+	require.Len(t, read, len(datasets))
+	for i := range datasets[:4] {
+		require.Equal(t, datasets[i], read[i])
+	}
+	require.Equal(t, "empty", read[4].name)
+	require.Equal(t, 0, read[4].Len())
+}
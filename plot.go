@@ -0,0 +1,35 @@
+package hdrbench
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/octo47/hdrbench/gnuplot"
+)
+
+// NewPlotter creates a plotter producing image `output`.
+// If script is true no gnuplot process is started, instead a gnuplot script
+// with the same base name as `output` and its data files are written next
+// to it, to be rendered later with `gnuplot <name>.gp` from that directory.
+// Returned name is how the output should be referred to in `set output`.
+func NewPlotter(output string, script bool) (*gnuplot.Plotter, string, error) {
+	if !script {
+		p, err := gnuplot.NewPlotter("", false, false)
+		return p, output, err
+	}
+	base := filepath.Base(output)
+	fname := filepath.Join(filepath.Dir(output),
+		strings.TrimSuffix(base, filepath.Ext(base))+".gp")
+	p, err := gnuplot.NewPlotter(fname, false, false)
+	return p, base, err
+}
+
+// RenderPlot writes all plotted data sets into image `output`.
+// Plots should be prepared with `set terminal unknown`, so partial plots
+// aren't rendered anywhere.
+func RenderPlot(p *gnuplot.Plotter, terminal string, output string) {
+	p.CheckedCmd("set terminal " + terminal)
+	p.CheckedCmd("set output '" + output + "'")
+	p.CheckedCmd("replot")
+	p.CheckedCmd("unset output")
+}
@@ -0,0 +1,86 @@
+package hdrbench
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// UniformQuantiles makes grid of quantiles step apart from step to 1.0.
+func UniformQuantiles(step float64) []float64 {
+	count := int(math.Floor(1/step + 0.5))
+	quantiles := make([]float64, count)
+	for i := range quantiles {
+		quantiles[i] = float64(i+1) / float64(count)
+	}
+	return quantiles
+}
+
+// NinesQuantiles makes grid of quantiles log-spaced by number of nines:
+// perDecade quantiles for every nine from 0.9 to maxNines nines,
+// e.g. maxNines 3 with perDecade 1 is 0.9, 0.99, 0.999.
+func NinesQuantiles(maxNines, perDecade int) []float64 {
+	quantiles := make([]float64, 0, maxNines*perDecade)
+	// rounding drops noise of 1 - 10^x, keeping digits the nines need
+	precision := math.Pow10(maxNines + 3)
+	for k := 1; k <= maxNines*perDecade; k++ {
+		q := 1 - math.Pow(10, -float64(k)/float64(perDecade))
+		quantiles = append(quantiles, math.Floor(q*precision+0.5)/precision)
+	}
+	return quantiles
+}
+
+// ParseQuantiles parses quantile grid specification. Grid is either
+// comma separated quantiles, "uniform:<step>" or "nines:<max nines>[:<per nine>]".
+// Grids joined with '+' are merged, e.g. "uniform:0.01+nines:5".
+func ParseQuantiles(spec string) ([]float64, error) {
+	quantiles := make([]float64, 0)
+	for _, grid := range strings.Split(spec, "+") {
+		grid = strings.TrimSpace(grid)
+		fields := strings.Split(grid, ":")
+		switch fields[0] {
+		case "uniform":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("expected uniform:<step>, got %q", grid)
+			}
+			step, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || step <= 0 || step > 1 {
+				return nil, fmt.Errorf("invalid uniform step in %q", grid)
+			}
+			quantiles = append(quantiles, UniformQuantiles(step)...)
+		case "nines":
+			if len(fields) < 2 || len(fields) > 3 {
+				return nil, fmt.Errorf("expected nines:<max nines>[:<per nine>], got %q", grid)
+			}
+			nines, err := strconv.Atoi(fields[1])
+			if err != nil || nines < 1 || nines > 12 {
+				return nil, fmt.Errorf("invalid number of nines in %q", grid)
+			}
+			perDecade := 1
+			if len(fields) == 3 {
+				if perDecade, err = strconv.Atoi(fields[2]); err != nil || perDecade < 1 {
+					return nil, fmt.Errorf("invalid quantiles per nine in %q", grid)
+				}
+			}
+			quantiles = append(quantiles, NinesQuantiles(nines, perDecade)...)
+		default:
+			for _, field := range strings.Split(grid, ",") {
+				q, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+				if err != nil || q < 0 || q > 1 {
+					return nil, fmt.Errorf("invalid quantile %q", field)
+				}
+				quantiles = append(quantiles, q)
+			}
+		}
+	}
+	quantiles = QSortFloat(quantiles)
+	// drop duplicates of merged grids
+	uniq := quantiles[:0]
+	for i, q := range quantiles {
+		if i == 0 || q != quantiles[i-1] {
+			uniq = append(uniq, q)
+		}
+	}
+	return uniq, nil
+}
@@ -0,0 +1,66 @@
+package hdrbench
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuantiles(t *testing.T) {
+	q, err := ParseQuantiles("nines:4")
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.9, 0.99, 0.999, 0.9999}, q)
+
+	q, err = ParseQuantiles("nines:2:2")
+	require.NoError(t, err)
+	require.Len(t, q, 4)
+	require.InDelta(t, 0.68377, q[0], 1e-5)
+	require.Equal(t, 0.99, q[3])
+
+	q, err = ParseQuantiles("uniform:0.25+0.5,0.999+nines:2")
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1.0}, q)
+
+	require.Len(t, UniformQuantiles(0.001), 1000)
+
+	for _, spec := range []string{"uniform:0", "nines:x", "1.5", "nines:1:2:3"} {
+		_, err = ParseQuantiles(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestQuantileHighRanks(t *testing.T) {
+	numbers := make([]float64, 1000000)
+	for i := range numbers {
+		numbers[i] = float64(i)
+	}
+	// nearest rank: the smallest value with at least q of values up to it
+	expected := []int64{899999, 989999, 998999, 999899, 999989, 999998}
+	for i, q := range NinesQuantiles(6, 1) {
+		v, pos := Quantile(numbers, q)
+		require.Equal(t, expected[i], pos, "q %v", q)
+		require.Equal(t, float64(pos), v)
+	}
+	v, _ := Quantile(numbers[:100], 0.145)
+	require.Equal(t, 14.0, v)
+	// 100 * 0.07 is 7.000000000000001 in floating point
+	v, _ = Quantile(numbers[:100], 0.07)
+	require.Equal(t, 6.0, v)
+	v, _ = Quantile(numbers[:1000], 0.9995)
+	require.Equal(t, 999.0, v)
+	v, _ = Quantile(numbers[:1000], 0.999)
+	require.Equal(t, 998.0, v)
+	v, _ = Quantile(numbers[:10000], 0.9999)
+	require.Equal(t, 9998.0, v)
+	v, _ = Quantile(numbers, 0)
+	require.Equal(t, 0.0, v)
+
+	// ranks of huge datasets aren't snapped to neighbouring integers
+	require.Equal(t, int64(499999999), quantilePosition(1e9, 0.5))
+	require.Equal(t, int64(899999999), quantilePosition(1e9, 0.9))
+	require.Equal(t, int64(500000000), quantilePosition(1e9, 0.5000000005))
+	lower, _ := quantileInterpolation(1e9, 0.5000000004, InvertedCDF)
+	require.Equal(t, int64(500000000), lower)
+	lower, _ = quantileInterpolation(10, 0.3, InvertedCDF)
+	require.Equal(t, int64(2), lower)
+}
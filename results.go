@@ -0,0 +1,194 @@
+package hdrbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Results are errors of histograms measured by a run of the benchmark,
+// stored to compare runs with each other.
+type Results struct {
+	// Quantiles of relative errors distribution reported for every backend
+	Quantiles []float64 `json:"quantiles"`
+	// Definition of quantiles, empty for native one
+	QuantileMethod string       `json:"quantile_method,omitempty"`
+	Config         RunConfig    `json:"config"`
+	Runs           []*RunResult `json:"runs"`
+}
+
+// RunConfig describes inputs of a run and configuration of backends,
+// only runs of the same configuration can be compared.
+type RunConfig struct {
+	Seed       int64   `json:"seed"`
+	Datapoints int     `json:"datapoints"`
+	Iterations int     `json:"iterations"`
+	Outliers   int     `json:"outliers"`
+	SampleRate float64 `json:"sample_rate"`
+	// Applied workload or input file
+	Workload string `json:"workload"`
+	// Grid of quantiles errors are measured at, as specified
+	QuantileGrid     string `json:"quantile_grid"`
+	MinSignals       int    `json:"min_signals"`
+	MaxSignals       int    `json:"max_signals"`
+	SignalMultiplier int    `json:"signal_multiplier"`
+	// How values are recorded: generated, input, stream, stream-input
+	// or arrivals of Arrivals process into time windows
+	Mode       string  `json:"mode"`
+	Arrivals   string  `json:"arrivals,omitempty"`
+	Window     float64 `json:"window,omitempty"`
+	WindowStep float64 `json:"window_step,omitempty"`
+	// Configuration of backends
+	IntScale        float64 `json:"int_scale"`
+	CirconusDigits  int     `json:"circonus_digits"`
+	CirconusMaxBins int     `json:"circonus_max_bins"`
+}
+
+// RunResult holds errors measured for a number of signals.
+type RunResult struct {
+	Signals  int              `json:"signals"`
+	Backends []*BackendResult `json:"backends"`
+}
+
+// BackendResult holds errors of a single histogram.
+type BackendResult struct {
+	Name    string `json:"name"`
+	UsedMem int64  `json:"used_mem"`
+	// Relative errors at Results.Quantiles averaged over iterations
+	Errors []float64 `json:"errors"`
+}
+
+// ResultDelta is a difference between current and baseline value of a metric.
+type ResultDelta struct {
+	Signals int
+	Backend string
+	// Error quantile or -1 for memory usage
+	Quantile   float64
+	Baseline   float64
+	Current    float64
+	Regression bool
+	// Backend or run of baseline isn't in current results,
+	// such deltas are regressions without values
+	Missing bool
+}
+
+// WriteResults stores results as JSON.
+func WriteResults(w io.Writer, results *Results) error {
+	enc, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(enc)
+	return err
+}
+
+// ReadResults reads results stored by WriteResults.
+func ReadResults(r io.Reader) (*Results, error) {
+	results := new(Results)
+	if err := json.NewDecoder(r).Decode(results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// LoadResults reads results from file.
+func LoadResults(fname string) (*Results, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadResults(f)
+}
+
+// CompareResults compares errors and memory usage of every backend of every
+// run of baseline with current results of the same run configuration.
+// Error regresses when it grows by more than tolerance (absolute, 0.001
+// is 0.1%), memory regresses when it grows by more than memTolerance of
+// the baseline. Backends and runs missing from current results regress.
+func CompareResults(current, baseline *Results, tolerance, memTolerance float64) ([]ResultDelta, error) {
+	if len(current.Quantiles) != len(baseline.Quantiles) {
+		return nil, fmt.Errorf("results have different quantiles: %v and %v",
+			current.Quantiles, baseline.Quantiles)
+	}
+	for i := range current.Quantiles {
+		if current.Quantiles[i] != baseline.Quantiles[i] {
+			return nil, fmt.Errorf("results have different quantiles: %v and %v",
+				current.Quantiles, baseline.Quantiles)
+		}
+	}
+	if current.QuantileMethod != baseline.QuantileMethod {
+		return nil, fmt.Errorf("results have different quantile methods: %q and %q",
+			current.QuantileMethod, baseline.QuantileMethod)
+	}
+	if current.Config != baseline.Config {
+		return nil, fmt.Errorf("results have different run configurations: %+v and %+v",
+			current.Config, baseline.Config)
+	}
+
+	deltas := make([]ResultDelta, 0)
+	for _, baseRun := range baseline.Runs {
+		run := current.run(baseRun.Signals)
+		if run == nil {
+			run = &RunResult{Signals: baseRun.Signals}
+		}
+		for _, baseBackend := range baseRun.Backends {
+			backend := run.backend(baseBackend.Name)
+			if backend == nil {
+				deltas = append(deltas, ResultDelta{
+					Signals:    run.Signals,
+					Backend:    baseBackend.Name,
+					Quantile:   -1,
+					Baseline:   float64(baseBackend.UsedMem),
+					Regression: true,
+					Missing:    true,
+				})
+				continue
+			}
+			if len(backend.Errors) != len(current.Quantiles) ||
+				len(baseBackend.Errors) != len(current.Quantiles) {
+				return nil, fmt.Errorf("%s with %d signals: expected %d errors",
+					backend.Name, run.Signals, len(current.Quantiles))
+			}
+			for qi, q := range current.Quantiles {
+				deltas = append(deltas, ResultDelta{
+					Signals:    run.Signals,
+					Backend:    backend.Name,
+					Quantile:   q,
+					Baseline:   baseBackend.Errors[qi],
+					Current:    backend.Errors[qi],
+					Regression: backend.Errors[qi] > baseBackend.Errors[qi]+tolerance,
+				})
+			}
+			deltas = append(deltas, ResultDelta{
+				Signals:  run.Signals,
+				Backend:  backend.Name,
+				Quantile: -1,
+				Baseline: float64(baseBackend.UsedMem),
+				Current:  float64(backend.UsedMem),
+				Regression: float64(backend.UsedMem) >
+					float64(baseBackend.UsedMem)*(1+memTolerance),
+			})
+		}
+	}
+	return deltas, nil
+}
+
+func (results *Results) run(signals int) *RunResult {
+	for _, run := range results.Runs {
+		if run.Signals == signals {
+			return run
+		}
+	}
+	return nil
+}
+
+func (run *RunResult) backend(name string) *BackendResult {
+	for _, backend := range run.Backends {
+		if backend.Name == name {
+			return backend
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package hdrbench
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareResults(t *testing.T) {
+	baseline := &Results{
+		Quantiles: []float64{0.5, 0.99},
+		Runs: []*RunResult{{
+			Signals: 3,
+			Backends: []*BackendResult{
+				{Name: "HDR", UsedMem: 1000, Errors: []float64{0.01, 0.02}},
+				{Name: "Circonus", UsedMem: 1000, Errors: []float64{0.01, 0.02}},
+			},
+		}},
+	}
+	buf := new(bytes.Buffer)
+	require.NoError(t, WriteResults(buf, baseline))
+	current, err := ReadResults(buf)
+	require.NoError(t, err)
+	require.Equal(t, baseline, current)
+
+	current.Runs[0].Backends[0].Errors[1] = 0.0205
+	current.Runs[0].Backends[1].Errors[1] = 0.03
+	current.Runs[0].Backends[1].UsedMem = 1200
+	deltas, err := CompareResults(current, baseline, 0.001, 0.1)
+	require.NoError(t, err)
+	require.Len(t, deltas, 6)
+	regressions := make([]ResultDelta, 0)
+	for _, delta := range deltas {
+		if delta.Regression {
+			regressions = append(regressions, delta)
+		}
+	}
+	require.Len(t, regressions, 2)
+	require.Equal(t, "Circonus", regressions[0].Backend)
+	require.Equal(t, 0.99, regressions[0].Quantile)
+	require.Equal(t, -1.0, regressions[1].Quantile)
+
+	current.QuantileMethod = Linear.String()
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+
+	current.QuantileMethod = ""
+	current.Quantiles = []float64{0.5, 0.999}
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+}
+
+func TestCompareResultsConfig(t *testing.T) {
+	config := RunConfig{Seed: 1234, Datapoints: 240, Iterations: 5, Outliers: 1,
+		SampleRate: 1, Workload: "default", QuantileGrid: "uniform:0.001", Mode: "generated",
+		IntScale: 10, CirconusDigits: 2}
+	baseline := &Results{
+		Quantiles: []float64{0.5},
+		Config:    config,
+		Runs: []*RunResult{
+			{Signals: 3, Backends: []*BackendResult{
+				{Name: "HDR", UsedMem: 1000, Errors: []float64{0.01}},
+				{Name: "Circonus", UsedMem: 1000, Errors: []float64{0.01}},
+			}},
+			{Signals: 90, Backends: []*BackendResult{
+				{Name: "HDR", UsedMem: 1000, Errors: []float64{0.01}},
+			}},
+		},
+	}
+	current := &Results{
+		Quantiles: []float64{0.5},
+		Config:    config,
+		Runs: []*RunResult{
+			{Signals: 3, Backends: []*BackendResult{
+				{Name: "HDR", UsedMem: 1000, Errors: []float64{0.01}},
+			}},
+		},
+	}
+	deltas, err := CompareResults(current, baseline, 0.001, 0.1)
+	require.NoError(t, err)
+	missing := make([]ResultDelta, 0)
+	for _, delta := range deltas {
+		if delta.Missing {
+			require.True(t, delta.Regression)
+			missing = append(missing, delta)
+		}
+	}
+	require.Len(t, missing, 2)
+	require.Equal(t, "Circonus", missing[0].Backend)
+	require.Equal(t, 90, missing[1].Signals)
+
+	current.Config.Seed = 1
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+	current.Config = config
+	current.Config.Workload = "burst"
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+	current.Config = config
+	current.Config.QuantileGrid = "nines:3"
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+	current.Config = config
+	current.Config.CirconusMaxBins = 100
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+	current.Config = config
+	current.Config.Mode = "stream"
+	_, err = CompareResults(current, baseline, 0.001, 0.1)
+	require.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package hdrbench
+
+import (
+	"fmt"
+)
+
+// RollupResolution holds errors of rolled up histograms of one resolution.
+type RollupResolution struct {
+	// Length of a window in seconds
+	Seconds int
+	// window -> quantile, relative errors against exact quantiles
+	// over the same raw values
+	Errors [][]float64
+}
+
+// Rollup records datasets into per second histograms and rolls them up by
+// merging: factors[i] windows of a resolution are merged into a single window
+// of the next one, e.g. 60, 60 for 1s -> 1m -> 1h. Every pointsPerSecond values
+// of a dataset are a second. Only complete windows are rolled up.
+// Quantiles of every window are compared with exact quantiles of raw values
+// of the window by method, windows estimate quantiles like proto does.
+func Rollup(proto Histogram, datasets []*Dataset, pointsPerSecond int, factors []int,
+	quantiles []float64, method QuantileMethod) ([]RollupResolution, error) {
+
+	if pointsPerSecond < 1 {
+		return nil, fmt.Errorf("Rollup needs at least 1 point per second, got %d", pointsPerSecond)
+	}
+	length := 0
+	for _, dataset := range datasets {
+		if dataset.Len() > length {
+			length = dataset.Len()
+		}
+	}
+	exact := func(seconds, window int) ([]float64, error) {
+		hist, _ := NewPreceiseHist()
+		if err := SetQuantileMethod(hist, method); err != nil {
+			return nil, err
+		}
+		start := window * seconds * pointsPerSecond
+		if err := hist.RecordValues(datasets, start, start+seconds*pointsPerSecond); err != nil {
+			return nil, err
+		}
+		return hist.Quantiles(quantiles)
+	}
+
+	windows := make([]Histogram, length/pointsPerSecond)
+	for s := range windows {
+		windows[s] = proto.Empty()
+		err := windows[s].RecordValues(datasets, s*pointsPerSecond, (s+1)*pointsPerSecond)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resolutions := make([]RollupResolution, 0, len(factors)+1)
+	seconds := 1
+	for level := 0; ; level++ {
+		resolution := RollupResolution{
+			Seconds: seconds,
+			Errors:  make([][]float64, len(windows)),
+		}
+		for w, hist := range windows {
+			exactQ, err := exact(seconds, w)
+			if err != nil {
+				return nil, err
+			}
+			histQ, err := hist.Quantiles(quantiles)
+			if err != nil {
+				return nil, err
+			}
+			resolution.Errors[w] = DiffRelative(exactQ, histQ)
+		}
+		resolutions = append(resolutions, resolution)
+		if level == len(factors) {
+			break
+		}
+
+		factor := factors[level]
+		rolled := make([]Histogram, len(windows)/factor)
+		for w := range rolled {
+			rolled[w] = proto.Empty()
+			for _, hist := range windows[w*factor : (w+1)*factor] {
+				if err := rolled[w].Merge(hist); err != nil {
+					return nil, err
+				}
+			}
+		}
+		windows = rolled
+		seconds *= factor
+	}
+	return resolutions, nil
+}
@@ -0,0 +1,272 @@
+package hdrbench
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// SelectQuantiles returns quantiles qin of numbers estimated by method
+// without sorting them: order statistics the quantiles need are selected
+// with Floyd-Rivest algorithm, numbers are reordered in place. NaNs
+// aren't supported.
+func SelectQuantiles(numbers []float64, qin []float64, method QuantileMethod) []float64 {
+	lowers := make([]int64, len(qin))
+	fractions := make([]float64, len(qin))
+	ranks := make([]int, 0, 2*len(qin))
+	for i, q := range qin {
+		lowers[i], fractions[i] = quantileInterpolation(int64(len(numbers)), q, method)
+		ranks = append(ranks, int(lowers[i]))
+		if fractions[i] > 0 {
+			ranks = append(ranks, int(lowers[i])+1)
+		}
+	}
+	sort.Ints(ranks)
+	unique := ranks[:0]
+	for i, rank := range ranks {
+		if i == 0 || rank != ranks[i-1] {
+			unique = append(unique, rank)
+		}
+	}
+	multiSelect(numbers, 0, len(numbers)-1, unique)
+
+	result := make([]float64, len(qin))
+	for i := range qin {
+		result[i] = numbers[lowers[i]]
+		if fractions[i] > 0 {
+			result[i] += fractions[i] * (numbers[lowers[i]+1] - numbers[lowers[i]])
+		}
+	}
+	return result
+}
+
+// multiSelect places k-th smallest value of a[left:right+1] at index k
+// for every of sorted ranks, selecting the middle rank first splits
+// the rest of them between two independent halves.
+func multiSelect(a []float64, left, right int, ranks []int) {
+	if len(ranks) == 0 || left >= right {
+		return
+	}
+	mid := len(ranks) / 2
+	k := ranks[mid]
+	floydRivest(a, left, right, k)
+	multiSelect(a, left, k-1, ranks[:mid])
+	multiSelect(a, k+1, right, ranks[mid+1:])
+}
+
+// floydRivest rearranges a[left:right+1] so a[k] is in its sorted position,
+// values before it aren't greater and values after it aren't smaller.
+// Pivot is selected from a sample, so ranges shrink fast even for sorted
+// input, partitioning stops on equal values, so duplicates are split evenly.
+func floydRivest(a []float64, left, right, k int) {
+	for right > left {
+		if right-left > 600 {
+			n := float64(right - left + 1)
+			i := float64(k - left + 1)
+			z := math.Log(n)
+			s := 0.5 * math.Exp(2*z/3)
+			sd := 0.5 * math.Sqrt(z*s*(n-s)/n)
+			if i < n/2 {
+				sd = -sd
+			}
+			newLeft := int(float64(k) - i*s/n + sd)
+			if newLeft < left {
+				newLeft = left
+			}
+			newRight := int(float64(k) + (n-i)*s/n + sd)
+			if newRight > right {
+				newRight = right
+			}
+			floydRivest(a, newLeft, newRight, k)
+		}
+		t := a[k]
+		i, j := left, right
+		a[left], a[k] = a[k], a[left]
+		if a[right] > t {
+			a[left], a[right] = a[right], a[left]
+		}
+		for i < j {
+			a[i], a[j] = a[j], a[i]
+			i++
+			j--
+			for a[i] < t {
+				i++
+			}
+			for a[j] > t {
+				j--
+			}
+		}
+		if a[left] == t {
+			a[left], a[j] = a[j], a[left]
+		} else {
+			j++
+			a[j], a[right] = a[right], a[j]
+		}
+		if j <= k {
+			left = j + 1
+		}
+		if k <= j {
+			right = j - 1
+		}
+	}
+}
+
+const (
+	// shorter slices are sorted by sort.Float64s
+	radixMinLen = 256
+	// minimal number of values sorted by a goroutine
+	radixChunkLen = 1 << 16
+)
+
+// RadixSortFloat sorts values in place with LSD radix sort of their bits,
+// a byte per pass. Counting and scattering of every pass are split between
+// GOMAXPROCS goroutines, passes where all values share the byte are skipped.
+// Needs two more slices of len(values) and isn't affected by order or
+// duplicates of values. NaNs are placed at the ends by their sign bit.
+func RadixSortFloat(values []float64) []float64 {
+	if len(values) < radixMinLen {
+		sort.Float64s(values)
+		return values
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if max := len(values) / radixChunkLen; workers > max {
+		workers = max
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	keys := make([]uint64, len(values))
+	buf := make([]uint64, len(values))
+	parallelChunks(workers, len(values), func(_, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			keys[i] = floatKey(values[i])
+		}
+	})
+	// counts, then offsets of every byte value in every chunk
+	counts := make([][256]int, workers)
+	for shift := uint(0); shift < 64; shift += 8 {
+		parallelChunks(workers, len(keys), func(w, lo, hi int) {
+			c := &counts[w]
+			*c = [256]int{}
+			for _, k := range keys[lo:hi] {
+				c[k>>shift&0xff]++
+			}
+		})
+		// chunks take consecutive places within a byte value,
+		// so every pass is stable
+		offset, skip := 0, false
+		for b := 0; b < 256; b++ {
+			total := 0
+			for w := range counts {
+				total += counts[w][b]
+			}
+			if total == len(keys) {
+				skip = true
+				break
+			}
+			for w := range counts {
+				n := counts[w][b]
+				counts[w][b] = offset
+				offset += n
+			}
+		}
+		if skip {
+			continue
+		}
+		parallelChunks(workers, len(keys), func(w, lo, hi int) {
+			c := &counts[w]
+			for _, k := range keys[lo:hi] {
+				b := k >> shift & 0xff
+				buf[c[b]] = k
+				c[b]++
+			}
+		})
+		keys, buf = buf, keys
+	}
+	parallelChunks(workers, len(values), func(_, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			values[i] = keyFloat(keys[i])
+		}
+	})
+	return values
+}
+
+// distinctSamples is number of values sampled to estimate
+// how many distinct values are there.
+const distinctSamples = 256
+
+// sortValues sorts values in place by the sort fastest for them: sorted
+// values are kept, values of few distinct ones are sorted by sort.Float64s
+// and the rest by RadixSortFloat.
+func sortValues(values []float64) []float64 {
+	if sort.Float64sAreSorted(values) {
+		return values
+	}
+	if len(values) >= radixMinLen && fewDistinct(values) {
+		sort.Float64s(values)
+		return values
+	}
+	return RadixSortFloat(values)
+}
+
+// fewDistinct tells if evenly spaced samples of values have less
+// than a quarter of distinct values.
+func fewDistinct(values []float64) bool {
+	samples := make([]float64, distinctSamples)
+	step := len(values) / distinctSamples
+	for i := range samples {
+		samples[i] = values[i*step]
+	}
+	sort.Float64s(samples)
+	distinct := 1
+	for i := 1; i < len(samples); i++ {
+		if samples[i] != samples[i-1] {
+			distinct++
+		}
+	}
+	return distinct < distinctSamples/4
+}
+
+// floatKey maps float64 to uint64 keeping the order: sign bit is flipped
+// for positive values, all bits are flipped for negative ones.
+func floatKey(v float64) uint64 {
+	b := math.Float64bits(v)
+	if b>>63 == 1 {
+		return ^b
+	}
+	return b | 1<<63
+}
+
+func keyFloat(k uint64) float64 {
+	if k>>63 == 1 {
+		return math.Float64frombits(k &^ (1 << 63))
+	}
+	return math.Float64frombits(^k)
+}
+
+// parallelChunks splits [0, n) into workers chunks and calls f for every
+// chunk in its own goroutine.
+func parallelChunks(workers, n int, f func(worker, lo, hi int)) {
+	if workers == 1 {
+		f(0, 0, n)
+		return
+	}
+	chunk := (n + workers - 1) / workers
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		lo, hi := w*chunk, (w+1)*chunk
+		if hi > n {
+			hi = n
+		}
+		if lo > hi {
+			lo = hi
+		}
+		wg.Add(1)
+		go func(w, lo, hi int) {
+			defer wg.Done()
+			f(w, lo, hi)
+		}(w, lo, hi)
+	}
+	wg.Wait()
+}
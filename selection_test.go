@@ -0,0 +1,117 @@
+package hdrbench
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// selectionInputs are random, sorted, reversed and duplicated values.
+func selectionInputs(rnd *rand.Rand, n int) map[string][]float64 {
+	inputs := map[string][]float64{
+		"random":     make([]float64, n),
+		"sorted":     make([]float64, n),
+		"reversed":   make([]float64, n),
+		"duplicates": make([]float64, n),
+	}
+	for i := 0; i < n; i++ {
+		inputs["random"][i] = rnd.NormFloat64() * 1000
+		inputs["sorted"][i] = float64(i)
+		inputs["reversed"][i] = float64(n - i)
+		inputs["duplicates"][i] = float64(rnd.Intn(5))
+	}
+	return inputs
+}
+
+func TestSelectQuantiles(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	quantiles := []float64{0.999, 0, 0.1, 0.5, 0.5, 0.77, 0.99, 1}
+	for _, n := range []int{1, 7, 1000, 100000} {
+		for name, values := range selectionInputs(rnd, n) {
+			sorted := make([]float64, n)
+			copy(sorted, values)
+			sort.Float64s(sorted)
+			for _, method := range []QuantileMethod{NativeQuantiles, AveragedInvertedCDF, Linear} {
+				selected := make([]float64, n)
+				copy(selected, values)
+				require.Equal(t, EstimateQuantiles(sorted, quantiles, method),
+					SelectQuantiles(selected, quantiles, method), "%s %d %v", name, n, method)
+			}
+		}
+	}
+}
+
+func TestRadixSortFloat(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	rnd := rand.New(rand.NewSource(1234))
+	special := []float64{math.Inf(-1), math.Inf(1), 0, math.Copysign(0, -1),
+		-math.MaxFloat64, math.SmallestNonzeroFloat64, -math.SmallestNonzeroFloat64}
+	for _, n := range []int{10, 1000, 300000} {
+		for name, values := range selectionInputs(rnd, n) {
+			values = append(values, special...)
+			expected := make([]float64, len(values))
+			copy(expected, values)
+			sort.Float64s(expected)
+			require.Equal(t, expected, RadixSortFloat(values), "%s %d", name, n)
+		}
+	}
+}
+
+func TestSortValues(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	for _, n := range []int{0, 1, 1000, 100000} {
+		for name, values := range selectionInputs(rnd, n) {
+			expected := make([]float64, n)
+			copy(expected, values)
+			sort.Float64s(expected)
+			require.Equal(t, expected, sortValues(values), "%s %d", name, n)
+		}
+	}
+}
+
+func benchmarkSort(b *testing.B, input string, sortFloats func([]float64)) {
+	b.StopTimer()
+	values := selectionInputs(rand.New(rand.NewSource(1234)), 1000000)[input]
+	buf := make([]float64, len(values))
+	for i := 0; i < b.N; i++ {
+		copy(buf, values)
+		b.StartTimer()
+		sortFloats(buf)
+		b.StopTimer()
+	}
+}
+
+func sortFloat64s(values []float64)    { sort.Float64s(values) }
+func qsortFloat(values []float64)      { QSortFloat(values) }
+func radixSortFloat(values []float64)  { RadixSortFloat(values) }
+func sortValuesFloat(values []float64) { sortValues(values) }
+
+// selectGrid selects quantiles of the default uniform:0.001 grid.
+func selectGrid(values []float64) {
+	SelectQuantiles(values, UniformQuantiles(0.001), NativeQuantiles)
+}
+
+// selectFew selects quantiles usually reported.
+func selectFew(values []float64) {
+	SelectQuantiles(values, []float64{0.5, 0.9, 0.99, 0.999}, NativeQuantiles)
+}
+
+func BenchmarkSortFloat64sRandom(b *testing.B)       { benchmarkSort(b, "random", sortFloat64s) }
+func BenchmarkSortFloat64sSorted(b *testing.B)       { benchmarkSort(b, "sorted", sortFloat64s) }
+func BenchmarkSortFloat64sDuplicates(b *testing.B)   { benchmarkSort(b, "duplicates", sortFloat64s) }
+func BenchmarkQSortFloatRandom(b *testing.B)         { benchmarkSort(b, "random", qsortFloat) }
+func BenchmarkQSortFloatSorted(b *testing.B)         { benchmarkSort(b, "sorted", qsortFloat) }
+func BenchmarkRadixSortFloatRandom(b *testing.B)     { benchmarkSort(b, "random", radixSortFloat) }
+func BenchmarkRadixSortFloatSorted(b *testing.B)     { benchmarkSort(b, "sorted", radixSortFloat) }
+func BenchmarkRadixSortFloatDuplicates(b *testing.B) { benchmarkSort(b, "duplicates", radixSortFloat) }
+func BenchmarkSortValuesRandom(b *testing.B)         { benchmarkSort(b, "random", sortValuesFloat) }
+func BenchmarkSortValuesSorted(b *testing.B)         { benchmarkSort(b, "sorted", sortValuesFloat) }
+func BenchmarkSortValuesDuplicates(b *testing.B)     { benchmarkSort(b, "duplicates", sortValuesFloat) }
+func BenchmarkSelectGridRandom(b *testing.B)         { benchmarkSort(b, "random", selectGrid) }
+func BenchmarkSelectFewRandom(b *testing.B)          { benchmarkSort(b, "random", selectFew) }
+func BenchmarkSelectFewSorted(b *testing.B)          { benchmarkSort(b, "sorted", selectFew) }
+func BenchmarkSelectFewDuplicates(b *testing.B)      { benchmarkSort(b, "duplicates", selectFew) }
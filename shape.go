@@ -0,0 +1,96 @@
+package hdrbench
+
+import (
+	"math"
+)
+
+// ShapeTrim is proportion of values trimmed or winsorized at every end.
+const ShapeTrim = 0.1
+
+// ShapeSample is maximal number of values robust statistics and tail
+// index of datasets are calculated from.
+const ShapeSample = 1 << 20
+
+// Shape characterizes distribution of values: robust statistics are
+// insensitive to outliers, while skewness, kurtosis and tail index
+// show how asymmetric and heavy tailed it is.
+type Shape struct {
+	Count          int64
+	Mean, StdDev   float64
+	Min, Max       float64
+	Median, MAD    float64
+	TrimmedMean    float64
+	WinsorizedMean float64
+	Skewness       float64
+	Kurtosis       float64
+	// Hill estimator from sqrt(Count) largest values
+	TailIndex float64
+}
+
+// NewShape calculates shape of values, values are sorted in place.
+func NewShape(values []float64) Shape {
+	shape := SummaryShape(NewSummary(values))
+	shape.addRobust(values)
+	return shape
+}
+
+// addRobust calculates robust statistics and tail index of values,
+// values are sorted in place.
+func (shape *Shape) addRobust(values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	sorted := RadixSortFloat(values)
+	shape.Median = Median(sorted)
+	shape.MAD = MAD(sorted)
+	shape.TrimmedMean = TrimmedMean(sorted, ShapeTrim)
+	shape.WinsorizedMean = WinsorizedMean(sorted, ShapeTrim)
+	shape.TailIndex = HillTailIndex(sorted, int(math.Sqrt(float64(len(sorted)))))
+}
+
+// SummaryShape is the part of shape known from summary of values,
+// robust statistics and tail index need values and are left zero.
+func SummaryShape(summary Summary) Shape {
+	return Shape{
+		Count:    summary.Count(),
+		Mean:     summary.Mean(),
+		StdDev:   summary.StdDev(),
+		Min:      summary.Min(),
+		Max:      summary.Max(),
+		Skewness: summary.Skewness(),
+		Kurtosis: summary.Kurtosis(),
+	}
+}
+
+// DatasetsShape calculates shape of values of all datasets together,
+// weights of values are ignored. Moments are exact, robust statistics and
+// tail index are of every k-th value, so at most ShapeSample values are
+// copied.
+func DatasetsShape(datasets []*Dataset) Shape {
+	var summary Summary
+	total := 0
+	for _, dataset := range datasets {
+		if dataset.HasWeights() {
+			summary.Merge(NewSummary(dataset.dataset))
+		} else {
+			summary.Merge(dataset.Summary())
+		}
+		total += dataset.Len()
+	}
+	step := (total + ShapeSample - 1) / ShapeSample
+	if step < 1 {
+		step = 1
+	}
+	sample := make([]float64, 0, (total+step-1)/step)
+	idx := 0
+	for _, dataset := range datasets {
+		// continue the stride of the previous dataset
+		for i := (step - idx%step) % step; i < dataset.Len(); i += step {
+			sample = append(sample, dataset.dataset[i])
+		}
+		idx += dataset.Len()
+	}
+	shape := SummaryShape(summary)
+	shape.addRobust(sample)
+	return shape
+}
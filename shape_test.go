@@ -0,0 +1,117 @@
+package hdrbench
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRobustStatistics(t *testing.T) {
+	require.Equal(t, 1.0, MAD([]float64{1, 1, 2, 2, 4, 6, 9}))
+	outlier := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 1000}
+	require.InDelta(t, 104.5, Mean(outlier), 1e-12)
+	require.InDelta(t, 5.5, TrimmedMean(outlier, 0.1), 1e-12)
+	require.InDelta(t, 5.5, WinsorizedMean(outlier, 0.1), 1e-12)
+	// at least the median is left
+	require.InDelta(t, 5.0, TrimmedMean([]float64{1, 5, 9}, 0.5), 1e-12)
+}
+
+func TestSummaryMoments(t *testing.T) {
+	summary := NewSummary([]float64{1, 2, 3, 10})
+	require.InDelta(t, 2*180/math.Pow(50, 1.5), summary.Skewness(), 1e-12)
+	require.InDelta(t, 4*1394.0/2500-3, summary.Kurtosis(), 1e-12)
+
+	var weighted Summary
+	weighted.AddWeighted(1, 2)
+	weighted.AddWeighted(10, 1)
+	repeated := NewSummary([]float64{1, 1, 10})
+	require.InDelta(t, repeated.Skewness(), weighted.Skewness(), 1e-12)
+	require.InDelta(t, repeated.Kurtosis(), weighted.Kurtosis(), 1e-12)
+	require.Equal(t, 0.0, NewSummary([]float64{3, 3}).Skewness())
+}
+
+func TestShape(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	normal := make([]float64, 200000)
+	exponential := make([]float64, len(normal))
+	pareto := make([]float64, len(normal))
+	for i := range normal {
+		normal[i] = 100 + rnd.NormFloat64()*10
+		exponential[i] = rnd.ExpFloat64()
+		pareto[i] = math.Pow(1-rnd.Float64(), -1/1.5)
+	}
+	shape := NewShape(normal)
+	require.Equal(t, int64(len(normal)), shape.Count)
+	require.InDelta(t, 100, shape.Median, 0.2)
+	// MAD of normal distribution is 0.6745 sigma
+	require.InDelta(t, 6.745, shape.MAD, 0.1)
+	require.InDelta(t, 0, shape.Skewness, 0.05)
+	require.InDelta(t, 0, shape.Kurtosis, 0.1)
+
+	shape = NewShape(exponential)
+	require.InDelta(t, 2, shape.Skewness, 0.2)
+	require.InDelta(t, 6, shape.Kurtosis, 1)
+	require.True(t, shape.TrimmedMean < shape.Mean)
+
+	shape = NewShape(pareto)
+	require.InDelta(t, 1.5, shape.TailIndex, 0.3)
+	require.True(t, math.IsNaN(HillTailIndex([]float64{-2, -1, 0}, 1)))
+
+	datasets := NewSkewDatasets(rnd, 1000, 2, 10.0)
+	shape = DatasetsShape(datasets)
+	require.Equal(t, int64(2000), shape.Count)
+	require.True(t, shape.Min < 0)
+	all := append(append([]float64{}, datasets[0].dataset...), datasets[1].dataset...)
+	expected := NewShape(all)
+	require.Equal(t, expected.Median, shape.Median)
+	require.InDelta(t, expected.Mean, shape.Mean, 1e-9)
+}
+
+func TestDatasetsShapeSample(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := make([]*Dataset, 3)
+	all := make([]float64, 0)
+	for i := range datasets {
+		values := make([]float64, ShapeSample/2+1)
+		for j := range values {
+			values[j] = rnd.ExpFloat64()
+		}
+		all = append(all, values...)
+		datasets[i] = NewDataset("exp", values, 0, 0)
+	}
+	shape := DatasetsShape(datasets)
+	expected := NewShape(all)
+	// moments are exact, robust statistics are of a sample
+	require.Equal(t, expected.Count, shape.Count)
+	require.Equal(t, expected.Max, shape.Max)
+	require.InDelta(t, expected.Mean, shape.Mean, 1e-9)
+	require.InDelta(t, expected.Kurtosis, shape.Kurtosis, 1e-6)
+	require.InDelta(t, expected.Median, shape.Median, 0.01)
+	require.InDelta(t, expected.MAD, shape.MAD, 0.01)
+	require.InDelta(t, expected.TrimmedMean, shape.TrimmedMean, 0.01)
+}
+
+func TestSummaryShape(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = rnd.ExpFloat64()
+	}
+	// summary merged over windows like streamed values
+	var summary Summary
+	for start := 0; start < len(values); start += 1000 {
+		summary.Merge(NewSummary(values[start : start+1000]))
+	}
+	shape := SummaryShape(summary)
+	expected := NewShape(values)
+	require.Equal(t, expected.Count, shape.Count)
+	require.Equal(t, expected.Min, shape.Min)
+	require.Equal(t, expected.Max, shape.Max)
+	require.InDelta(t, expected.Mean, shape.Mean, 1e-9)
+	require.InDelta(t, expected.StdDev, shape.StdDev, 1e-9)
+	require.InDelta(t, expected.Skewness, shape.Skewness, 1e-9)
+	require.InDelta(t, expected.Kurtosis, shape.Kurtosis, 1e-9)
+	require.Equal(t, 0.0, shape.Median)
+}
@@ -0,0 +1,257 @@
+package hdrbench
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+)
+
+// spillRuns keeps sorted runs of values in files, so Precise histogram
+// could hold more values than fits in memory.
+type spillRuns struct {
+	dir   string
+	limit int
+	// directory of runs of this histogram within dir, created on first spill
+	runDir string
+	files  []string
+	count  int64
+}
+
+// write stores sorted values as a run of big endian float64.
+func (s *spillRuns) write(values []float64) error {
+	if s.runDir == "" {
+		runDir, err := ioutil.TempDir(s.dir, "hdrbench-spill")
+		if err != nil {
+			return err
+		}
+		s.runDir = runDir
+	}
+	f, err := ioutil.TempFile(s.runDir, "run")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s.files = append(s.files, f.Name())
+	w := bufio.NewWriter(f)
+	var buf [8]byte
+	for _, v := range values {
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	s.count += int64(len(values))
+	return w.Flush()
+}
+
+func (s *spillRuns) remove() {
+	for _, fname := range s.files {
+		os.Remove(fname)
+	}
+	s.files = nil
+	s.count = 0
+}
+
+// close removes runs with their directory.
+func (s *spillRuns) close() error {
+	s.remove()
+	if s.runDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.runDir)
+	s.runDir = ""
+	return err
+}
+
+// runReader reads values of a sorted run one by one.
+type runReader struct {
+	r    *bufio.Reader
+	head float64
+}
+
+func (rr *runReader) next() (bool, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(rr.r, buf[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	rr.head = math.Float64frombits(binary.BigEndian.Uint64(buf[:]))
+	return true, nil
+}
+
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].head < h[j].head }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	rr := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return rr
+}
+
+// merge walks through all spilled values and sorted in-memory values
+// in ascending order calling visit for every value till it returns false.
+func (s *spillRuns) merge(sorted []float64, visit func(v float64) bool) error {
+	h := make(runHeap, 0, len(s.files)+1)
+	for _, fname := range s.files {
+		f, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rr := &runReader{r: bufio.NewReader(f)}
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, rr)
+		}
+	}
+	mem := 0
+	heap.Init(&h)
+	for h.Len() > 0 || mem < len(sorted) {
+		var v float64
+		if h.Len() == 0 || (mem < len(sorted) && sorted[mem] < h[0].head) {
+			v = sorted[mem]
+			mem++
+		} else {
+			v = h[0].head
+			ok, err := h[0].next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+		if !visit(v) {
+			break
+		}
+	}
+	return nil
+}
+
+// quantiles of spilled and sorted in-memory values, see EstimateQuantiles.
+func (s *spillRuns) quantiles(sorted []float64, qin []float64, method QuantileMethod) ([]float64, error) {
+	total := s.count + int64(len(sorted))
+	// values at positions of both ends of interpolation are visited
+	// in ascending order of positions, ends of quantile i are 2*i and 2*i+1
+	order := make([]int, 2*len(qin))
+	positions := make([]int64, 2*len(qin))
+	fractions := make([]float64, len(qin))
+	for i, q := range qin {
+		lower, fraction := quantileInterpolation(total, q, method)
+		fractions[i] = fraction
+		order[2*i], order[2*i+1] = 2*i, 2*i+1
+		positions[2*i], positions[2*i+1] = lower, lower
+		if fraction > 0 {
+			positions[2*i+1] = lower + 1
+		}
+	}
+	sort.Sort(byPosition{order, positions})
+
+	ends := make([]float64, len(order))
+	next := 0
+	pos := int64(0)
+	err := s.merge(sorted, func(v float64) bool {
+		for next < len(order) && positions[order[next]] == pos {
+			ends[order[next]] = v
+			next++
+		}
+		pos++
+		return next < len(order)
+	})
+	qout := make([]float64, len(qin))
+	for i := range qout {
+		qout[i] = ends[2*i]
+		if fractions[i] > 0 {
+			qout[i] += fractions[i] * (ends[2*i+1] - ends[2*i])
+		}
+	}
+	return qout, err
+}
+
+type byPosition struct {
+	order     []int
+	positions []int64
+}
+
+func (b byPosition) Len() int { return len(b.order) }
+func (b byPosition) Less(i, j int) bool {
+	return b.positions[b.order[i]] < b.positions[b.order[j]]
+}
+func (b byPosition) Swap(i, j int) { b.order[i], b.order[j] = b.order[j], b.order[i] }
+
+// load reads all spilled values merged with sorted in-memory ones
+// and removes runs.
+func (s *spillRuns) load(sorted []float64) ([]float64, error) {
+	values := make([]float64, 0, s.count+int64(len(sorted)))
+	err := s.merge(sorted, func(v float64) bool {
+		values = append(values, v)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.remove()
+	return values, nil
+}
+
+// NewSpillingPreciseHist creates Precise histogram keeping up to limit values
+// in memory, the rest is spilled to sorted runs in dir (system temporary
+// directory if empty). Quantiles are calculated by merging the runs,
+// Buckets, Merge, MarshalBinary and SortedValues load all values back.
+// Spilled values are kept till Reset or Close.
+func NewSpillingPreciseHist(dir string, limit int) (Histogram, error) {
+	return &preciseHistogram{
+		merged: make([]float64, 0),
+		spill:  &spillRuns{dir: dir, limit: limit},
+	}, nil
+}
+
+// spillIfFull moves values to a new run if there are more than limit of them.
+func (hhist *preciseHistogram) spillIfFull() error {
+	if hhist.spill == nil || len(hhist.merged) <= hhist.spill.limit {
+		return nil
+	}
+	if hhist.weights != nil {
+		return errors.New("Spilling of weighted values isn't supported")
+	}
+	hhist.merged = sortValues(hhist.merged)
+	if err := hhist.spill.write(hhist.merged); err != nil {
+		return err
+	}
+	hhist.merged = hhist.merged[:0]
+	return nil
+}
+
+// unspill loads spilled values back to memory.
+func (hhist *preciseHistogram) unspill() error {
+	if hhist.spill == nil || len(hhist.spill.files) == 0 {
+		return nil
+	}
+	if !hhist.sorted {
+		hhist.merged = sortValues(hhist.merged)
+	}
+	merged, err := hhist.spill.load(hhist.merged)
+	if err != nil {
+		return err
+	}
+	hhist.merged = merged
+	hhist.sorted = true
+	return nil
+}
@@ -0,0 +1,177 @@
+package hdrbench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/octo47/tsgen/generator"
+)
+
+// DataSource yields values of a signal lazily, so signals longer than
+// memory could be consumed window by window.
+type DataSource interface {
+	Name() string
+	// Next returns up to n next values appended to buf[:0],
+	// io.EOF after the last value.
+	Next(buf []float64, n int) ([]float64, error)
+}
+
+type generatorSource struct {
+	name   string
+	gen    generator.Generator
+	points []generator.Point
+	left   int
+}
+
+// NewLatencySource generates n values of a latency signal like
+// NewLatencyDataset does.
+func NewLatencySource(name string, baseSeed, mixinSeed int64, min, max float64, n int) DataSource {
+	baseRnd := rand.New(rand.NewSource(baseSeed))
+	mixinRnd := rand.New(rand.NewSource(mixinSeed))
+	diff := max - min
+	return &generatorSource{
+		name: name,
+		gen: generator.NewCombineGenerator(
+			generator.NewRandomWalkGenerator(baseRnd, diff/10.0, min, max),
+			[]generator.Generator{
+				generator.NewRandomWalkGenerator(mixinRnd, diff/1000, -diff/10, diff/10),
+			},
+		),
+		left: n,
+	}
+}
+
+// NewLatencySources creates sources of signals like NewLatencyDatasets does.
+func NewLatencySources(rnd *rand.Rand, n int, datasets int, outliers int) []DataSource {
+	sources := make([]DataSource, datasets+outliers)
+	mixinSeed := rnd.Int63()
+	for idx := 0; idx < datasets; idx++ {
+		sources[idx] = NewLatencySource("lowLatency"+strconv.Itoa(idx), rnd.Int63(), mixinSeed,
+			1.0, 1500.0, n)
+	}
+	for idx := datasets; idx < datasets+outliers; idx++ {
+		baseSeed := rnd.Int63()
+		mixinSeed := rnd.Int63()
+		minLat := float64(rnd.Intn(100))
+		sources[idx] = NewLatencySource("highLatancy"+strconv.Itoa(idx), baseSeed, mixinSeed,
+			minLat+1500.0, 10000.0, n)
+	}
+	return sources
+}
+
+func (gs *generatorSource) Name() string {
+	return gs.name
+}
+
+func (gs *generatorSource) Next(buf []float64, n int) ([]float64, error) {
+	if gs.left == 0 {
+		return buf[:0], io.EOF
+	}
+	if n > gs.left {
+		n = gs.left
+	}
+	if cap(gs.points) < n {
+		gs.points = make([]generator.Point, n)
+	}
+	gs.points = gs.points[:n]
+	gs.gen.Next(&gs.points)
+	gs.left -= n
+	buf = buf[:0]
+	for _, p := range gs.points {
+		buf = append(buf, p.Value)
+	}
+	return buf, nil
+}
+
+type readerSource struct {
+	name    string
+	scanner *bufio.Scanner
+	scale   float64
+}
+
+// NewReaderSource reads newline-delimited values from r, e.g. a file or
+// a pipe. Empty lines and lines starting with '#' are skipped, values are
+// multiplied by scale unless it's zero.
+func NewReaderSource(name string, r io.Reader, scale float64) DataSource {
+	if scale == 0 {
+		scale = 1.0
+	}
+	return &readerSource{name: name, scanner: bufio.NewScanner(r), scale: scale}
+}
+
+func (rs *readerSource) Name() string {
+	return rs.name
+}
+
+func (rs *readerSource) Next(buf []float64, n int) ([]float64, error) {
+	buf = buf[:0]
+	for len(buf) < n && rs.scanner.Scan() {
+		line := strings.TrimSpace(rs.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return buf, fmt.Errorf("%s: %v", rs.name, err)
+		}
+		buf = append(buf, v*rs.scale)
+	}
+	if err := rs.scanner.Err(); err != nil {
+		return buf, err
+	}
+	if len(buf) == 0 {
+		return buf, io.EOF
+	}
+	return buf, nil
+}
+
+type datasetSource struct {
+	dataset *Dataset
+	pos     int
+}
+
+// NewDatasetSource yields values of dataset.
+func NewDatasetSource(dataset *Dataset) DataSource {
+	return &datasetSource{dataset: dataset}
+}
+
+func (ds *datasetSource) Name() string {
+	return ds.dataset.name
+}
+
+func (ds *datasetSource) Next(buf []float64, n int) ([]float64, error) {
+	values := ds.dataset.values(ds.pos, ds.pos+n)
+	ds.pos += len(values)
+	if len(values) == 0 {
+		return buf[:0], io.EOF
+	}
+	return append(buf[:0], values...), nil
+}
+
+// NextWindow reads next n values of every source into datasets, datasets
+// of exhausted sources are empty. Returns io.EOF when all sources are
+// exhausted.
+func NextWindow(sources []DataSource, n int) ([]*Dataset, error) {
+	window := make([]*Dataset, len(sources))
+	buf := make([]float64, 0, n)
+	exhausted := 0
+	for i, source := range sources {
+		var err error
+		buf, err = source.Next(buf, n)
+		if err == io.EOF {
+			exhausted++
+		} else if err != nil {
+			return nil, err
+		}
+		window[i] = NewDataset(source.Name(), buf, math.Inf(-1), math.Inf(1))
+	}
+	if exhausted == len(sources) {
+		return nil, io.EOF
+	}
+	return window, nil
+}
@@ -0,0 +1,87 @@
+package hdrbench
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencySources(t *testing.T) {
+	datasets := NewLatencyDatasets(rand.New(rand.NewSource(1234)), 1000, 3, 1)
+	sources := NewLatencySources(rand.New(rand.NewSource(1234)), 1000, 3, 1)
+	require.Len(t, sources, len(datasets))
+	// windows of a source are the same values as the dataset
+	for start := 0; start < 1000; start += 300 {
+		window, err := NextWindow(sources, 300)
+		require.NoError(t, err)
+		for i := range datasets {
+			require.Equal(t, datasets[i].values(start, start+300), window[i].dataset)
+		}
+	}
+	_, err := NextWindow(sources, 300)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReaderSource(t *testing.T) {
+	source := NewReaderSource("pipe", strings.NewReader("1\n# comment\n2\n\n3\n"), 10)
+	buf, err := source.Next(nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, []float64{10, 20}, buf)
+	buf, err = source.Next(buf, 2)
+	require.NoError(t, err)
+	require.Equal(t, []float64{30}, buf)
+	_, err = source.Next(buf, 2)
+	require.Equal(t, io.EOF, err)
+
+	_, err = NewReaderSource("bad", strings.NewReader("x\n"), 0).Next(nil, 1)
+	require.Error(t, err)
+}
+
+func TestSpillingPreciseHist(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 1000, 5, 1)
+	precise, _ := NewPreceiseHist()
+	dir, err := ioutil.TempDir("", "hdrbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	spilling, _ := NewSpillingPreciseHist(dir, 700)
+	for _, hist := range []Histogram{precise, spilling} {
+		for start := 0; start < 1000; start += 100 {
+			require.NoError(t, hist.RecordValues(datasets, start, start+100))
+		}
+	}
+	require.True(t, len(spilling.(*preciseHistogram).spill.files) > 1)
+	require.True(t, spilling.UsedMem() <= 8*700)
+
+	quantiles := []float64{0.99, 0.0, 0.5, 0.999, 1.0, 0.5}
+	expected, _ := precise.Quantiles(quantiles)
+	actual, err := spilling.Quantiles(quantiles)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+	for _, method := range []QuantileMethod{AveragedInvertedCDF, Linear, NormalUnbiased} {
+		require.NoError(t, SetQuantileMethod(precise, method))
+		require.NoError(t, SetQuantileMethod(spilling, method))
+		expected, _ = precise.Quantiles(quantiles)
+		actual, err = spilling.Quantiles(quantiles)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual, "%v", method)
+	}
+
+	sorted, err := SortedValues(spilling)
+	require.NoError(t, err)
+	expectedSorted, _ := SortedValues(precise)
+	require.Equal(t, expectedSorted, sorted)
+	require.Len(t, spilling.(*preciseHistogram).spill.files, 0)
+
+	require.NoError(t, spilling.RecordValues(datasets, 0, 1000))
+	require.True(t, len(spilling.(*preciseHistogram).spill.files) > 0)
+	require.NoError(t, spilling.(io.Closer).Close())
+	left, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, left, 0)
+}
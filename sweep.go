@@ -0,0 +1,168 @@
+package hdrbench
+
+import (
+	"fmt"
+)
+
+// SweepConfig is a backend configuration to be evaluated by Sweep.
+type SweepConfig struct {
+	Name string
+	New  func() (Histogram, error)
+}
+
+// SweepPoint is accuracy and cost of a backend configuration.
+type SweepPoint struct {
+	Config string
+	// Maximal memory used by a window
+	UsedMem int64
+	// Maximal size of a window histogram encoded with MarshalBinary
+	EncodedSize int64
+	// Relative errors at quantiles averaged over windows
+	Errors []float64
+}
+
+// HdrSweepConfigs makes HDR configuration for every combination
+// of significant figures and int scale.
+func HdrSweepConfigs(sigfigs []int, scales []float64) []SweepConfig {
+	configs := make([]SweepConfig, 0, len(sigfigs)*len(scales))
+	for _, sig := range sigfigs {
+		for _, scale := range scales {
+			sig, scale := sig, scale
+			configs = append(configs, SweepConfig{
+				Name: fmt.Sprintf("HDR sigfigs=%d int-scale=%v", sig, scale),
+				New: func() (Histogram, error) {
+					return NewHdrHist(0, 1000, sig, scale)
+				},
+			})
+		}
+	}
+	return configs
+}
+
+// CirconusSweepConfigs makes Circonus configuration for every combination
+// of significant digits and max bins, 0 max bins aren't capped.
+func CirconusSweepConfigs(digits []int, maxBins []int) []SweepConfig {
+	configs := make([]SweepConfig, 0, len(digits)*len(maxBins))
+	for _, d := range digits {
+		for _, bins := range maxBins {
+			d, bins := d, bins
+			configs = append(configs, SweepConfig{
+				Name: fmt.Sprintf("Circonus digits=%d max-bins=%d", d, bins),
+				New: func() (Histogram, error) {
+					return NewCirconusHist(d, bins)
+				},
+			})
+		}
+	}
+	return configs
+}
+
+// Sweep records windows of window values of datasets into histogram of every
+// configuration and measures errors of quantiles by method against exact ones,
+// configurations not supporting method estimate their native quantiles.
+func Sweep(configs []SweepConfig, datasets []*Dataset, window, windows int,
+	quantiles []float64, method QuantileMethod) ([]SweepPoint, error) {
+
+	exact := make([][]float64, windows)
+	for w := range exact {
+		hist, _ := NewPreceiseHist()
+		if err := SetQuantileMethod(hist, method); err != nil {
+			return nil, err
+		}
+		if err := hist.RecordValues(datasets, w*window, (w+1)*window); err != nil {
+			return nil, err
+		}
+		var err error
+		if exact[w], err = hist.Quantiles(quantiles); err != nil {
+			return nil, err
+		}
+	}
+
+	points := make([]SweepPoint, len(configs))
+	for ci, config := range configs {
+		hist, err := config.New()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", config.Name, err)
+		}
+		// unsupported method leaves native quantiles
+		SetQuantileMethod(hist, method)
+		point := SweepPoint{
+			Config: config.Name,
+			Errors: make([]float64, len(quantiles)),
+		}
+		for w := 0; w < windows; w++ {
+			hist.Reset()
+			if err := hist.RecordValues(datasets, w*window, (w+1)*window); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.Name, err)
+			}
+			histQ, err := hist.Quantiles(quantiles)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", config.Name, err)
+			}
+			for qi, diff := range DiffRelative(exact[w], histQ) {
+				point.Errors[qi] += diff / float64(windows)
+			}
+			if mem := hist.UsedMem(); mem > point.UsedMem {
+				point.UsedMem = mem
+			}
+			encoded, err := hist.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", config.Name, err)
+			}
+			if size := int64(len(encoded)); size > point.EncodedSize {
+				point.EncodedSize = size
+			}
+		}
+		points[ci] = point
+	}
+	return points, nil
+}
+
+// ParetoFrontier returns indexes of points not dominated by memory and error
+// at quantile qi: no other point uses less or equal memory with lower or
+// equal error being better in at least one of them. Indexes are ordered by
+// memory usage.
+func ParetoFrontier(points []SweepPoint, qi int) []int {
+	frontier := make([]int, 0)
+	for i, p := range points {
+		dominated := false
+		for j, o := range points {
+			if i == j {
+				continue
+			}
+			if o.UsedMem <= p.UsedMem && o.Errors[qi] <= p.Errors[qi] &&
+				(o.UsedMem < p.UsedMem || o.Errors[qi] < p.Errors[qi]) {
+				dominated = true
+				break
+			}
+		}
+		if dominated {
+			continue
+		}
+		// insertion keeps frontier ordered by memory
+		pos := len(frontier)
+		for pos > 0 && points[frontier[pos-1]].UsedMem > p.UsedMem {
+			pos--
+		}
+		frontier = append(frontier, 0)
+		copy(frontier[pos+1:], frontier[pos:])
+		frontier[pos] = i
+	}
+	return frontier
+}
+
+// Cheapest returns index of point using least memory with error at quantile
+// qi not exceeding maxErr, -1 if there is no such point.
+func Cheapest(points []SweepPoint, qi int, maxErr float64) int {
+	cheapest := -1
+	for i, p := range points {
+		if p.Errors[qi] > maxErr {
+			continue
+		}
+		if cheapest < 0 || p.UsedMem < points[cheapest].UsedMem ||
+			(p.UsedMem == points[cheapest].UsedMem && p.Errors[qi] < points[cheapest].Errors[qi]) {
+			cheapest = i
+		}
+	}
+	return cheapest
+}
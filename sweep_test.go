@@ -0,0 +1,44 @@
+package hdrbench
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParetoFrontier(t *testing.T) {
+	points := []SweepPoint{
+		{Config: "a", UsedMem: 300, Errors: []float64{0.001}},
+		{Config: "b", UsedMem: 100, Errors: []float64{0.05}},
+		{Config: "c", UsedMem: 200, Errors: []float64{0.05}},
+		{Config: "d", UsedMem: 200, Errors: []float64{0.008}},
+		{Config: "e", UsedMem: 400, Errors: []float64{0.002}},
+	}
+	require.Equal(t, []int{1, 3, 0}, ParetoFrontier(points, 0))
+	require.Equal(t, 3, Cheapest(points, 0, 0.01))
+	require.Equal(t, -1, Cheapest(points, 0, 0.0001))
+}
+
+func TestSweep(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	datasets := NewLatencyDatasets(rnd, 400, 10, 1)
+	configs := HdrSweepConfigs([]int{1, 3}, []float64{10})
+	points, err := Sweep(configs, datasets, 100, 4, []float64{0.5, 0.99}, NativeQuantiles)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	// more significant figures cost memory and improve accuracy
+	require.True(t, points[0].UsedMem < points[1].UsedMem)
+	require.True(t, points[0].EncodedSize > 0)
+	require.True(t, points[0].EncodedSize <= points[1].EncodedSize)
+	for qi := range points[0].Errors {
+		require.True(t, points[1].Errors[qi] <= points[0].Errors[qi])
+	}
+	require.InDelta(t, 0.0, points[1].Errors[1], 0.01)
+
+	// configurations estimate quantiles by the method of exact ones
+	configs = append(configs, SweepConfig{Name: "Precise", New: NewPreceiseHist})
+	points, err = Sweep(configs, datasets, 100, 4, []float64{0.5, 0.99}, Linear)
+	require.NoError(t, err)
+	require.Equal(t, []float64{0, 0}, points[2].Errors)
+}
@@ -0,0 +1,259 @@
+package hdrbench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// NewTimedDataset creates dataset of values arrived at timestamps (seconds),
+// timestamps must be non-decreasing.
+func NewTimedDataset(name string, timestamps, dataset []float64, upper, lower float64) (*Dataset, error) {
+	if len(timestamps) != len(dataset) {
+		return nil, fmt.Errorf("%s: %d timestamps for %d values", name, len(timestamps), len(dataset))
+	}
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] < timestamps[i-1] {
+			return nil, fmt.Errorf("%s: timestamp %d goes back in time", name, i)
+		}
+	}
+	ds := NewDataset(name, dataset, upper, lower)
+	ds.timestamps = make([]float64, len(timestamps))
+	copy(ds.timestamps, timestamps)
+	return ds, nil
+}
+
+// HasTime reports whether values of dataset have timestamps.
+func (fd *Dataset) HasTime() bool {
+	return fd.timestamps != nil
+}
+
+// Timestamps returns arrival times of values, nil if dataset has none.
+func (fd *Dataset) Timestamps() []float64 {
+	return fd.timestamps
+}
+
+// TimeRange returns indexes [start, stop) of values arrived in [from, to).
+func (fd *Dataset) TimeRange(from, to float64) (start, stop int) {
+	start = sort.SearchFloat64s(fd.timestamps, from)
+	stop = sort.SearchFloat64s(fd.timestamps, to)
+	if stop < start {
+		stop = start
+	}
+	return start, stop
+}
+
+// SliceTime returns dataset of values arrived in [from, to).
+func (fd *Dataset) SliceTime(from, to float64) *Dataset {
+	start, stop := fd.TimeRange(from, to)
+	ds := NewDataset(fd.name, fd.dataset[start:stop], fd.upperBound, fd.lowerBound)
+	ds.timestamps = make([]float64, stop-start)
+	copy(ds.timestamps, fd.timestamps[start:stop])
+	if fd.weights != nil {
+		weights := make([]float64, stop-start)
+		copy(weights, fd.weights[start:stop])
+		ds.setWeights(weights)
+	}
+	return ds
+}
+
+// Resample turns irregular arrivals into values interval apart: values
+// arrived within an interval are aggregated by aggregate (e.g. Mean or
+// Median of sorted values), intervals without arrivals repeat the previous
+// value. Timestamps of the result are starts of intervals, weights aren't
+// kept, every resampled value weights 1.
+func (fd *Dataset) Resample(interval float64, aggregate func([]float64) float64) (*Dataset, error) {
+	if !(interval > 0) {
+		return nil, fmt.Errorf("%s: resampling interval must be positive, got %v", fd.name, interval)
+	}
+	if len(fd.timestamps) == 0 {
+		return NewDataset(fd.name, nil, fd.upperBound, fd.lowerBound), nil
+	}
+	first := math.Floor(fd.timestamps[0]/interval) * interval
+	count := int((fd.timestamps[len(fd.timestamps)-1]-first)/interval) + 1
+	timestamps := make([]float64, count)
+	values := make([]float64, count)
+	bucket := make([]float64, 0)
+	idx := 0
+	for i := range values {
+		timestamps[i] = first + float64(i)*interval
+		bucket = bucket[:0]
+		for ; idx < len(fd.timestamps) && fd.timestamps[idx] < timestamps[i]+interval; idx++ {
+			bucket = append(bucket, fd.dataset[idx])
+		}
+		if len(bucket) == 0 {
+			values[i] = values[i-1]
+			continue
+		}
+		values[i] = aggregate(QSortFloat(bucket))
+	}
+	ds := NewDataset(fd.name, values, fd.upperBound, fd.lowerBound)
+	ds.timestamps = timestamps
+	return ds, nil
+}
+
+// TimeWindow is [Start, End) time range.
+type TimeWindow struct {
+	Start, End float64
+}
+
+// TimeWindows splits time range covered by all datasets into windows of width
+// seconds starting every step seconds: fixed windows if step equals width,
+// sliding if it's less. Only complete windows are returned.
+func TimeWindows(datasets []*Dataset, width, step float64) ([]TimeWindow, error) {
+	if !(width > 0) || !(step > 0) {
+		return nil, fmt.Errorf("window width and step must be positive, got %v and %v", width, step)
+	}
+	from, to := math.Inf(1), math.Inf(-1)
+	for _, dataset := range datasets {
+		if len(dataset.timestamps) == 0 {
+			continue
+		}
+		from = math.Min(from, dataset.timestamps[0])
+		to = math.Max(to, dataset.timestamps[len(dataset.timestamps)-1])
+	}
+	windows := make([]TimeWindow, 0)
+	for start := from; start+width <= to; start += step {
+		windows = append(windows, TimeWindow{start, start + width})
+	}
+	return windows, nil
+}
+
+// RecordTimeWindow records values of datasets arrived within window.
+func RecordTimeWindow(hist Histogram, datasets []*Dataset, window TimeWindow) error {
+	sliced := make([]*Dataset, len(datasets))
+	length := 0
+	for i, dataset := range datasets {
+		sliced[i] = dataset.SliceTime(window.Start, window.End)
+		if sliced[i].Len() > length {
+			length = sliced[i].Len()
+		}
+	}
+	return hist.RecordValues(sliced, 0, length)
+}
+
+// ArrivalProcess generates intervals between arrivals of values.
+type ArrivalProcess interface {
+	Next(rnd *rand.Rand) float64
+}
+
+// RegularArrivals arrive every Interval seconds.
+type RegularArrivals struct {
+	Interval float64
+}
+
+func (a *RegularArrivals) Next(rnd *rand.Rand) float64 {
+	return a.Interval
+}
+
+// PoissonArrivals arrive with Rate per second on average,
+// intervals between arrivals are exponentially distributed.
+type PoissonArrivals struct {
+	Rate float64
+}
+
+func (a *PoissonArrivals) Next(rnd *rand.Rand) float64 {
+	return rnd.ExpFloat64() / a.Rate
+}
+
+// BurstyArrivals switch between Poisson arrivals with Rate and bursts of
+// arrivals with BurstRate, durations of bursts and quiet periods are
+// exponentially distributed with means Burst and Idle seconds.
+type BurstyArrivals struct {
+	Rate, BurstRate float64
+	Burst, Idle     float64
+
+	bursting bool
+	// time left till switch
+	left float64
+}
+
+func (a *BurstyArrivals) Next(rnd *rand.Rand) float64 {
+	interval := 0.0
+	for {
+		rate := a.Rate
+		if a.bursting {
+			rate = a.BurstRate
+		}
+		next := rnd.ExpFloat64() / rate
+		if next <= a.left {
+			a.left -= next
+			return interval + next
+		}
+		// memoryless, so arrival is redrawn with the other rate after switch
+		interval += a.left
+		a.bursting = !a.bursting
+		if a.bursting {
+			a.left = rnd.ExpFloat64() * a.Burst
+		} else {
+			a.left = rnd.ExpFloat64() * a.Idle
+		}
+	}
+}
+
+// Arrivals generates n timestamps starting from 0.
+func Arrivals(rnd *rand.Rand, process ArrivalProcess, n int) []float64 {
+	timestamps := make([]float64, n)
+	now := 0.0
+	for i := range timestamps {
+		now += process.Next(rnd)
+		timestamps[i] = now
+	}
+	return timestamps
+}
+
+// NewTimedLatencyDatasets generates latency datasets as NewLatencyDatasets
+// with arrival times generated by process made by newProcess for every
+// dataset.
+func NewTimedLatencyDatasets(rnd *rand.Rand, n int, datasets int, outliers int,
+	newProcess func() ArrivalProcess) []*Dataset {
+
+	ds := NewLatencyDatasets(rnd, n, datasets, outliers)
+	for _, dataset := range ds {
+		dataset.timestamps = Arrivals(rnd, newProcess(), dataset.Len())
+	}
+	return ds
+}
+
+// ParseArrivals parses arrival process specification, one of
+//
+//	regular:interval=1
+//	poisson:rate=1
+//	bursty:rate=1,burst-rate=20,burst=5,idle=60
+//
+// and returns constructor of the process.
+func ParseArrivals(spec string) (func() ArrivalProcess, error) {
+	name, params, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	for key, v := range params {
+		if v <= 0 {
+			return nil, fmt.Errorf("%s: %s must be a positive number", name, key)
+		}
+	}
+	param := params.take
+
+	var newProcess func() ArrivalProcess
+	switch name {
+	case "regular":
+		interval := param("interval", 1)
+		newProcess = func() ArrivalProcess { return &RegularArrivals{interval} }
+	case "poisson":
+		rate := param("rate", 1)
+		newProcess = func() ArrivalProcess { return &PoissonArrivals{rate} }
+	case "bursty":
+		rate, burstRate := param("rate", 1), param("burst-rate", 20)
+		burst, idle := param("burst", 5), param("idle", 60)
+		newProcess = func() ArrivalProcess {
+			return &BurstyArrivals{Rate: rate, BurstRate: burstRate, Burst: burst, Idle: idle}
+		}
+	default:
+		return nil, fmt.Errorf("unknown arrival process %q", name)
+	}
+	if err := params.unknown(name); err != nil {
+		return nil, err
+	}
+	return newProcess, nil
+}
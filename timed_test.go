@@ -0,0 +1,71 @@
+package hdrbench
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSliceTime(t *testing.T) {
+	_, err := NewTimedDataset("bad", []float64{1, 0}, []float64{1, 2}, 0, 0)
+	require.Error(t, err)
+
+	ds, err := NewTimedDataset("timed",
+		[]float64{0.5, 1.0, 1.2, 3.5, 3.6, 7.0},
+		[]float64{1, 2, 3, 4, 5, 6}, 0, 0)
+	require.NoError(t, err)
+	sliced := ds.SliceTime(1.0, 3.6)
+	require.Equal(t, []float64{2, 3, 4}, sliced.dataset)
+	require.Equal(t, []float64{1.0, 1.2, 3.5}, sliced.Timestamps())
+	require.Equal(t, 4.0, sliced.Max())
+
+	resampled, err := ds.Resample(2, Mean)
+	require.NoError(t, err)
+	require.Equal(t, []float64{0, 2, 4, 6}, resampled.Timestamps())
+	// [6, 8) has no arrivals before 7.0 of the last one, [4, 6) repeats [2, 4)
+	require.Equal(t, []float64{2, 4.5, 4.5, 6}, resampled.dataset)
+
+	windows, err := TimeWindows([]*Dataset{ds}, 2, 1)
+	require.NoError(t, err)
+	require.Len(t, windows, 5)
+	require.Equal(t, TimeWindow{1.5, 3.5}, windows[1])
+	hist, _ := NewPreceiseHist()
+	require.NoError(t, RecordTimeWindow(hist, []*Dataset{ds, sliced}, windows[0]))
+	q, _ := hist.Quantiles([]float64{0.0, 1.0})
+	require.Equal(t, []float64{1, 3}, q)
+	require.Equal(t, int64(40), hist.UsedMem())
+
+	for _, size := range [][2]float64{{0, 1}, {2, 0}, {-1, 1}, {2, -1}} {
+		_, err = TimeWindows([]*Dataset{ds}, size[0], size[1])
+		require.Error(t, err, "%v", size)
+	}
+	_, err = ds.Resample(0, Mean)
+	require.Error(t, err)
+	_, err = ds.Resample(-2, Mean)
+	require.Error(t, err)
+}
+
+func TestArrivals(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	poisson := Arrivals(rnd, &PoissonArrivals{Rate: 10}, 10000)
+	require.InDelta(t, 1000, poisson[len(poisson)-1], 50)
+
+	newBursty, err := ParseArrivals("bursty:rate=1,burst-rate=100,burst=10,idle=10")
+	require.NoError(t, err)
+	bursty := Arrivals(rnd, newBursty(), 100000)
+	// half of the time is bursts, so ~50 arrivals per second on average
+	rate := float64(len(bursty)) / bursty[len(bursty)-1]
+	require.InDelta(t, 50, rate, 10)
+
+	_, err = ParseArrivals("poisson:rate=0")
+	require.Error(t, err)
+	_, err = ParseArrivals("poisson:foo=1")
+	require.Error(t, err)
+
+	ds := NewTimedLatencyDatasets(rnd, 100, 2, 1, func() ArrivalProcess {
+		return &RegularArrivals{Interval: 0.5}
+	})
+	require.Len(t, ds, 3)
+	require.Equal(t, 50.0, ds[2].Timestamps()[99])
+}
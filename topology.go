@@ -0,0 +1,89 @@
+package hdrbench
+
+import (
+	"strconv"
+)
+
+// topologyLevels are names of aggregation levels above signals.
+var topologyLevels = []string{"host", "rack", "region"}
+
+// TopologyLevel describes a single level of aggregation tree.
+type TopologyLevel struct {
+	Name  string
+	Nodes int
+	// Size of serialized histograms sent to the level,
+	// zero if histograms aren't serialized.
+	Bytes int
+}
+
+// TopologyLevelName returns name of aggregation level,
+// level 0 is the first one above signals.
+func TopologyLevelName(level int) string {
+	if level < len(topologyLevels) {
+		return topologyLevels[level]
+	}
+	return "level" + strconv.Itoa(level+1)
+}
+
+// AggregateTopology records every dataset into its own histogram and merges
+// them hop by hop up the aggregation tree: signals -> host -> rack ->
+// region -> global. fanOut[i] is number of nodes merged into a single node of
+// the next level, nodes left after the last level are merged into the global
+// histogram. If serialize is set histograms are serialized and deserialized
+// at every hop, as they would be sent over the wire.
+func AggregateTopology(proto Histogram, datasets []*Dataset, start, stop int,
+	fanOut []int, serialize bool) (Histogram, []TopologyLevel, error) {
+
+	nodes := make([]Histogram, len(datasets))
+	for i, dataset := range datasets {
+		nodes[i] = proto.Empty()
+		if err := nodes[i].RecordValues([]*Dataset{dataset}, start, stop); err != nil {
+			return nil, nil, err
+		}
+	}
+	levels := make([]TopologyLevel, 0, len(fanOut)+1)
+	for level := 0; level <= len(fanOut); level++ {
+		groupSize := len(nodes)
+		name := "global"
+		if level < len(fanOut) {
+			groupSize = fanOut[level]
+			name = TopologyLevelName(level)
+		}
+		if groupSize < 1 {
+			groupSize = 1
+		}
+		stats := TopologyLevel{Name: name}
+		parents := make([]Histogram, 0, (len(nodes)+groupSize-1)/groupSize)
+		for i := 0; i < len(nodes); i += groupSize {
+			parent := proto.Empty()
+			for _, child := range nodes[i:minInt(i+groupSize, len(nodes))] {
+				if serialize {
+					data, err := child.MarshalBinary()
+					if err != nil {
+						return nil, nil, err
+					}
+					stats.Bytes += len(data)
+					child = proto.Empty()
+					if err := child.UnmarshalBinary(data); err != nil {
+						return nil, nil, err
+					}
+				}
+				if err := parent.Merge(child); err != nil {
+					return nil, nil, err
+				}
+			}
+			parents = append(parents, parent)
+		}
+		stats.Nodes = len(parents)
+		levels = append(levels, stats)
+		nodes = parents
+	}
+	return nodes[0], levels, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
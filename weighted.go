@@ -0,0 +1,125 @@
+package hdrbench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// NewWeightedDataset creates dataset where every value stands for weight
+// values, e.g. 1/rate requests of a sampled trace. Weights must be positive.
+func NewWeightedDataset(name string, weights, dataset []float64, upper, lower float64) (*Dataset, error) {
+	if len(weights) != len(dataset) {
+		return nil, fmt.Errorf("%s: %d weights for %d values", name, len(weights), len(dataset))
+	}
+	for i, w := range weights {
+		if !(w > 0) || math.IsInf(w, 1) {
+			return nil, fmt.Errorf("%s: invalid weight %v of value %d", name, w, i)
+		}
+	}
+	ds := NewDataset(name, dataset, upper, lower)
+	dsWeights := make([]float64, len(weights))
+	copy(dsWeights, weights)
+	ds.setWeights(dsWeights)
+	return ds, nil
+}
+
+// setWeights assigns weights of values, summary becomes weighted.
+func (fd *Dataset) setWeights(weights []float64) {
+	fd.weights = weights
+	if weights == nil {
+		return
+	}
+	fd.summary = Summary{}
+	for i, v := range fd.dataset {
+		fd.summary.AddWeighted(v, weights[i])
+	}
+}
+
+// HasWeights reports whether values of dataset have weights.
+func (fd *Dataset) HasWeights() bool {
+	return fd.weights != nil
+}
+
+// Weights returns weights of values, nil if every value weights 1.
+func (fd *Dataset) Weights() []float64 {
+	return fd.weights
+}
+
+func (fd *Dataset) weight(idx int) float64 {
+	if fd.weights == nil {
+		return 1.0
+	}
+	return fd.weights[idx]
+}
+
+// TotalWeight returns sum of weights of values in [start, stop) range.
+func (fd *Dataset) TotalWeight(start, stop int) float64 {
+	start, stop = fd.span(start, stop)
+	if fd.weights == nil {
+		return float64(stop - start)
+	}
+	return Sum(fd.weights[start:stop])
+}
+
+// SampleDataset keeps every value in [start, stop) range with probability
+// rate and weights kept values by 1/rate. Timestamps are kept as well.
+func SampleDataset(rnd *rand.Rand, fd *Dataset, start, stop int, rate float64) *Dataset {
+	start, stop = fd.span(start, stop)
+	values := fd.dataset[start:stop]
+	sampled := make([]float64, 0, int(float64(len(values))*rate)+1)
+	weights := make([]float64, 0, cap(sampled))
+	var timestamps []float64
+	if fd.timestamps != nil {
+		timestamps = make([]float64, 0, cap(sampled))
+	}
+	for i, v := range values {
+		if rnd.Float64() >= rate {
+			continue
+		}
+		sampled = append(sampled, v)
+		weights = append(weights, fd.weight(start+i)/rate)
+		if fd.timestamps != nil {
+			timestamps = append(timestamps, fd.timestamps[start+i])
+		}
+	}
+	ds := NewDataset(fd.name, sampled, fd.upperBound, fd.lowerBound)
+	ds.setWeights(weights)
+	ds.timestamps = timestamps
+	return ds
+}
+
+// SampleDatasets samples values in [start, stop) range of every dataset.
+func SampleDatasets(rnd *rand.Rand, datasets []*Dataset, start, stop int, rate float64) []*Dataset {
+	sampled := make([]*Dataset, len(datasets))
+	for i, dataset := range datasets {
+		sampled[i] = SampleDataset(rnd, dataset, start, stop, rate)
+	}
+	return sampled
+}
+
+// weightCounter turns weights into integer counts for sketches,
+// fractions are carried over to following values, so total count
+// differs from total weight by less than one.
+type weightCounter struct {
+	carry float64
+}
+
+func (wc *weightCounter) count(weight float64) int64 {
+	wc.carry += weight
+	n := math.Floor(wc.carry)
+	wc.carry -= n
+	return int64(n)
+}
+
+// weightedValues sorts values together with their weights.
+type weightedValues struct {
+	values, weights []float64
+}
+
+func (wv weightedValues) Len() int           { return len(wv.values) }
+func (wv weightedValues) Less(i, j int) bool { return wv.values[i] < wv.values[j] }
+func (wv weightedValues) Swap(i, j int) {
+	wv.values[i], wv.values[j] = wv.values[j], wv.values[i]
+	wv.weights[i], wv.weights[j] = wv.weights[j], wv.weights[i]
+}
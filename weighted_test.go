@@ -0,0 +1,85 @@
+package hdrbench
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightedQuantiles(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	values := make([]float64, 100)
+	weights := make([]float64, len(values))
+	expanded := make([]float64, 0)
+	for i := range values {
+		values[i] = float64(i)
+		weights[i] = float64(1 + rnd.Intn(5))
+		for j := 0; j < int(weights[i]); j++ {
+			expanded = append(expanded, values[i])
+		}
+	}
+	quantiles := UniformQuantiles(0.001)
+	require.Equal(t, Quantiles(expanded, quantiles), WeightedQuantiles(values, weights, quantiles))
+}
+
+func TestSampleDataset(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	ds := NewLatencyDatasets(rnd, 100000, 1, 0)[0]
+	sampled := SampleDataset(rnd, ds, 0, 50000, 0.1)
+	require.True(t, sampled.HasWeights())
+	require.InDelta(t, 5000, sampled.Len(), 300)
+	require.InDelta(t, 50000, sampled.TotalWeight(0, sampled.Len()), 3000)
+	// values and weights
+	require.Equal(t, int64(16*sampled.Len()), sampled.UsedMem())
+	for _, w := range sampled.Weights() {
+		require.InDelta(t, 10.0, w, 1e-9)
+	}
+
+	_, err := NewWeightedDataset("invalid", []float64{1, 0}, []float64{1, 2}, 2, 1)
+	require.Error(t, err)
+}
+
+func TestWeightedRecording(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1234))
+	ds := NewLatencyDataset("ds", rnd.Int63(), rnd.Int63(), 1, 1200.0, 1000)
+	weights := make([]float64, ds.Len())
+	expanded := make([]float64, 0)
+	for i, v := range ds.dataset {
+		weights[i] = float64(1 + rnd.Intn(3))
+		for j := 0; j < int(weights[i]); j++ {
+			expanded = append(expanded, v)
+		}
+	}
+	weighted, err := NewWeightedDataset("weighted", weights, ds.dataset, 1200.0, 1)
+	require.NoError(t, err)
+	repeated := NewDataset("repeated", expanded, 1200.0, 1)
+	quantiles := []float64{0.1, 0.5, 0.9, 0.99}
+	for _, newHist := range []func() (Histogram, error){
+		NewPreceiseHist,
+		NewCircosusHist,
+		func() (Histogram, error) { return NewHdrHist(0, 1000000, 2, 100.0) },
+	} {
+		hist, _ := newHist()
+		require.NoError(t, hist.RecordValues([]*Dataset{weighted}, 0, weighted.Len()))
+		weightedQ, _ := hist.Quantiles(quantiles)
+		hist.Reset()
+		require.NoError(t, hist.RecordValues([]*Dataset{repeated}, 0, repeated.Len()))
+		repeatedQ, _ := hist.Quantiles(quantiles)
+		require.Equal(t, repeatedQ, weightedQ, hist.Name())
+	}
+
+	// unweighted values merged into weighted histogram weight 1
+	hist, _ := NewPreceiseHist()
+	other := hist.Empty()
+	require.NoError(t, hist.RecordValues([]*Dataset{ds}, 0, ds.Len()))
+	require.NoError(t, other.RecordValues([]*Dataset{weighted}, 0, weighted.Len()))
+	require.NoError(t, hist.Merge(other))
+	expected, _ := NewPreceiseHist()
+	require.NoError(t, expected.RecordValues([]*Dataset{ds, repeated}, 0, repeated.Len()))
+	histQ, _ := hist.Quantiles(quantiles)
+	expectedQ, _ := expected.Quantiles(quantiles)
+	require.Equal(t, expectedQ, histQ)
+	_, err = hist.MarshalBinary()
+	require.Error(t, err)
+}
@@ -0,0 +1,281 @@
+package hdrbench
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Workload changes latency of a dataset over time, values are addressed
+// by index and random draws don't depend on values, so a workload applied
+// with the same draws changes every dataset at the same moments.
+type Workload interface {
+	Name() string
+	// Apply modifies values in place and returns indexes
+	// where behaviour changes.
+	Apply(rnd *rand.Rand, values []float64) []int
+}
+
+// StepWorkload multiplies latency by Factor starting from value At.
+type StepWorkload struct {
+	At     int
+	Factor float64
+}
+
+func (w *StepWorkload) Name() string {
+	return "step"
+}
+
+func (w *StepWorkload) Apply(rnd *rand.Rand, values []float64) []int {
+	if w.At >= len(values) {
+		return nil
+	}
+	for i := w.At; i < len(values); i++ {
+		values[i] *= w.Factor
+	}
+	return []int{w.At}
+}
+
+// BurstWorkload multiplies latency by Factor for Length values every Period
+// values. Bursts start at random phase and Jitter randomly shifts every burst.
+type BurstWorkload struct {
+	Period, Length, Jitter int
+	Factor                 float64
+}
+
+func (w *BurstWorkload) Name() string {
+	return "burst"
+}
+
+func (w *BurstWorkload) Apply(rnd *rand.Rand, values []float64) []int {
+	changes := make([]int, 0)
+	for period := rnd.Intn(w.Period); period < len(values); period += w.Period {
+		start := period
+		if w.Jitter > 0 {
+			start += rnd.Intn(w.Jitter)
+		}
+		stop := start + w.Length
+		if start >= len(values) {
+			break
+		}
+		if stop > len(values) {
+			stop = len(values)
+		}
+		for i := start; i < stop; i++ {
+			values[i] *= w.Factor
+		}
+		changes = append(changes, start, stop)
+	}
+	return changes
+}
+
+// GCPauseWorkload adds pause in [Min, Max) to a value with probability Prob
+// and to values following it while the pause lasts, values are Interval apart.
+type GCPauseWorkload struct {
+	Prob, Min, Max, Interval float64
+}
+
+func (w *GCPauseWorkload) Name() string {
+	return "gc"
+}
+
+func (w *GCPauseWorkload) Apply(rnd *rand.Rand, values []float64) []int {
+	changes := make([]int, 0)
+	for i := 0; i < len(values); i++ {
+		if rnd.Float64() >= w.Prob {
+			continue
+		}
+		changes = append(changes, i)
+		// requests arriving during the pause wait for its end
+		pause := w.Min + rnd.Float64()*(w.Max-w.Min)
+		for ; pause > 0 && i < len(values); i++ {
+			values[i] += pause
+			pause -= w.Interval
+		}
+		// the value after the pause may start the next one
+		i--
+	}
+	return changes
+}
+
+// RampWorkload slowly degrades latency: multiplier grows linearly from 1 at
+// Start to Factor at Stop and stays at Factor after it.
+type RampWorkload struct {
+	Start, Stop int
+	Factor      float64
+}
+
+func (w *RampWorkload) Name() string {
+	return "ramp"
+}
+
+func (w *RampWorkload) Apply(rnd *rand.Rand, values []float64) []int {
+	for i := w.Start; i < len(values); i++ {
+		factor := w.Factor
+		if i < w.Stop {
+			factor = 1 + (w.Factor-1)*float64(i-w.Start)/float64(w.Stop-w.Start)
+		}
+		values[i] *= factor
+	}
+	return []int{w.Start, w.Stop}
+}
+
+// ApplyWorkloads applies workloads to copies of datasets with seeded random,
+// every workload makes the same draws for every dataset, so all datasets
+// change at the same moments. Returns modified datasets and sorted unique
+// change points, shorter datasets have a prefix of them.
+func ApplyWorkloads(datasets []*Dataset, workloads []Workload, seed int64) ([]*Dataset, []int) {
+	rnd := rand.New(rand.NewSource(seed))
+	seeds := make([]int64, len(workloads))
+	for wi := range seeds {
+		seeds[wi] = rnd.Int63()
+	}
+	changed := make(map[int]bool)
+	result := make([]*Dataset, len(datasets))
+	for di, dataset := range datasets {
+		values := make([]float64, len(dataset.dataset))
+		copy(values, dataset.dataset)
+		for wi, workload := range workloads {
+			draws := rand.New(rand.NewSource(seeds[wi]))
+			for _, change := range workload.Apply(draws, values) {
+				changed[change] = true
+			}
+		}
+		result[di] = NewDataset(dataset.name, values, dataset.upperBound, dataset.lowerBound)
+		result[di].timestamps = dataset.timestamps
+		result[di].setWeights(dataset.weights)
+	}
+	changes := make([]int, 0, len(changed))
+	for change := range changed {
+		changes = append(changes, change)
+	}
+	sort.Ints(changes)
+	return result, changes
+}
+
+// specParams are parameters of a spec parsed by parseSpec.
+type specParams map[string]float64
+
+// parseSpec parses name optionally followed by colon and comma separated
+// key=value parameters, e.g. burst:period=240,length=20.
+func parseSpec(spec string) (string, specParams, error) {
+	name, paramSpec := spec, ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		name, paramSpec = spec[:idx], spec[idx+1:]
+	}
+	params := make(specParams)
+	for _, param := range strings.Split(paramSpec, ",") {
+		if param == "" {
+			continue
+		}
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return name, nil, fmt.Errorf("%s: expected key=value, got %q", name, param)
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return name, nil, fmt.Errorf("%s: invalid %s: %v", name, kv[0], err)
+		}
+		params[kv[0]] = v
+	}
+	return name, params, nil
+}
+
+// take returns parameter key or def if it's missing, taken parameters
+// are removed, so parameters left are unknown.
+func (params specParams) take(key string, def float64) float64 {
+	v, ok := params[key]
+	if !ok {
+		return def
+	}
+	delete(params, key)
+	return v
+}
+
+// unknown fails if any parameter of name wasn't taken.
+func (params specParams) unknown(name string) error {
+	for key := range params {
+		return fmt.Errorf("%s: unknown parameter %q", name, key)
+	}
+	return nil
+}
+
+// ParseWorkloads parses workloads joined with '+', every workload is
+// a name followed by comma separated parameters, e.g.
+//
+//	step:at=600,factor=2+burst:period=240,length=20,factor=5
+//
+// Workloads and their parameters with defaults:
+//
+//	step:at=600,factor=2
+//	burst:period=240,length=20,jitter=0,factor=5
+//	gc:prob=0.001,min=100,max=1000,interval=10
+//	ramp:start=0,stop=1200,factor=3
+func ParseWorkloads(spec string) ([]Workload, error) {
+	workloads := make([]Workload, 0)
+	for _, field := range strings.Split(spec, "+") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, params, err := parseSpec(field)
+		if err != nil {
+			return nil, err
+		}
+		param := params.take
+
+		var workload Workload
+		switch name {
+		case "step":
+			w := &StepWorkload{
+				At:     int(param("at", 600)),
+				Factor: param("factor", 2),
+			}
+			if w.At < 0 || w.Factor <= 0 {
+				return nil, fmt.Errorf("step: at must not be negative and factor must be positive")
+			}
+			workload = w
+		case "burst":
+			w := &BurstWorkload{
+				Period: int(param("period", 240)),
+				Length: int(param("length", 20)),
+				Jitter: int(param("jitter", 0)),
+				Factor: param("factor", 5),
+			}
+			if w.Period < 1 || w.Length < 1 || w.Jitter < 0 {
+				return nil, fmt.Errorf("burst: period and length must be positive")
+			}
+			workload = w
+		case "gc":
+			w := &GCPauseWorkload{
+				Prob:     param("prob", 0.001),
+				Min:      param("min", 100),
+				Max:      param("max", 1000),
+				Interval: param("interval", 10),
+			}
+			if w.Interval <= 0 || w.Max < w.Min {
+				return nil, fmt.Errorf("gc: interval must be positive and max not less than min")
+			}
+			workload = w
+		case "ramp":
+			w := &RampWorkload{
+				Start:  int(param("start", 0)),
+				Stop:   int(param("stop", 1200)),
+				Factor: param("factor", 3),
+			}
+			if w.Start < 0 || w.Stop <= w.Start {
+				return nil, fmt.Errorf("ramp: stop must be greater than start")
+			}
+			workload = w
+		default:
+			return nil, fmt.Errorf("unknown workload %q", name)
+		}
+		if err := params.unknown(name); err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, workload)
+	}
+	return workloads, nil
+}
@@ -0,0 +1,81 @@
+package hdrbench
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func ones(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = 1
+	}
+	return values
+}
+
+func TestStepAndRampWorkloads(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := ones(10)
+	require.Equal(t, []int{4}, (&StepWorkload{At: 4, Factor: 2}).Apply(rnd, values))
+	require.Equal(t, []float64{1, 1, 1, 1, 2, 2, 2, 2, 2, 2}, values)
+
+	values = ones(10)
+	require.Equal(t, []int{2, 6}, (&RampWorkload{Start: 2, Stop: 6, Factor: 3}).Apply(rnd, values))
+	require.Equal(t, []float64{1, 1, 1, 1.5, 2, 2.5, 3, 3, 3, 3}, values)
+}
+
+func TestBurstWorkload(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := ones(100)
+	changes := (&BurstWorkload{Period: 20, Length: 5, Factor: 4}).Apply(rnd, values)
+	require.True(t, len(changes) >= 8)
+	bursts := 0
+	for _, v := range values {
+		if v == 4 {
+			bursts++
+		}
+	}
+	require.True(t, bursts >= 20 && bursts <= 25, "%d values in bursts", bursts)
+}
+
+func TestGCPauseWorkload(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := ones(10)
+	// every value pauses, a pause covers values arriving within 25
+	changes := (&GCPauseWorkload{Prob: 1, Min: 25, Max: 25, Interval: 10}).Apply(rnd, values)
+	require.Equal(t, []int{0, 3, 6, 9}, changes)
+	require.Equal(t, []float64{26, 16, 6, 26, 16, 6, 26, 16, 6, 26}, values)
+}
+
+func TestApplyWorkloads(t *testing.T) {
+	workloads, err := ParseWorkloads("step:at=50,factor=2+gc:prob=0.01,min=100,max=200")
+	require.NoError(t, err)
+	require.Len(t, workloads, 2)
+
+	datasets := []*Dataset{NewDataset("a", ones(100), 1, 1), NewDataset("b", ones(100), 1, 1)}
+	changed, changes := ApplyWorkloads(datasets, workloads, 1234)
+	require.Contains(t, changes, 50)
+	require.Equal(t, 1.0, datasets[0].Max(), "original datasets are kept")
+	require.True(t, changed[0].Max() >= 100)
+	require.True(t, changed[1].values(99, 100)[0] >= 2.0)
+
+	again, _ := ApplyWorkloads(datasets, workloads, 1234)
+	require.Equal(t, changed[1].dataset, again[1].dataset)
+
+	// random workloads change every dataset at the same moments
+	workloads, err = ParseWorkloads("burst:period=20,length=5,jitter=5,factor=4+gc:prob=0.05")
+	require.NoError(t, err)
+	changed, changes = ApplyWorkloads(datasets, workloads, 1234)
+	require.Equal(t, changed[0].dataset, changed[1].dataset)
+	single, singleChanges := ApplyWorkloads(datasets[:1], workloads, 1234)
+	require.Equal(t, singleChanges, changes)
+	require.Equal(t, single[0].dataset, changed[0].dataset)
+
+	for _, spec := range []string{"foo", "step:at", "step:foo=1", "ramp:start=5,stop=1",
+		"step:at=-1", "step:factor=0"} {
+		_, err = ParseWorkloads(spec)
+		require.Error(t, err, spec)
+	}
+}